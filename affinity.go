@@ -0,0 +1,88 @@
+package performance
+
+import (
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+const (
+	// CPUSetTag is a storage label that contains CPUs the benchmarked container is pinned to
+	CPUSetTag = "cpuset"
+	// CPUQuotaTag is a storage label that contains CPU quota of the benchmarked container in cores
+	CPUQuotaTag = "cpu_quota"
+	// MemoryLimitTag is a storage label that contains memory limit of the benchmarked container in bytes
+	MemoryLimitTag = "memory_limit"
+	// ClientCPUSetTag is a storage label that contains CPUs the benchmarking process is pinned to
+	ClientCPUSetTag = "client_cpuset"
+)
+
+var (
+	errInvalidCPUList = errors.NewKind("invalid CPU list %q, expected e.g. 0-3,6")
+	errCPUsOverlap    = errors.NewKind("CPU lists %q and %q overlap")
+	errPinFailed      = errors.NewKind("cannot pin the process to CPUs %q: %v")
+)
+
+// clientCPUSet is a list of CPUs the process is pinned to by PinProcess
+var clientCPUSet string
+
+// ParseCPUList parses a list of CPUs in the format of cpuset, e.g. "0-3,6"
+func ParseCPUList(list string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(list, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil || from < 0 {
+			return nil, errInvalidCPUList.New(list)
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.Atoi(bounds[1]); err != nil || to < from {
+				return nil, errInvalidCPUList.New(list)
+			}
+		}
+		for c := from; c <= to; c++ {
+			cpus = append(cpus, c)
+		}
+	}
+	return cpus, nil
+}
+
+// CheckDisjointCPUs returns an error if given CPU lists have common CPUs, empty lists are ignored
+func CheckDisjointCPUs(a, b string) error {
+	if a == "" || b == "" {
+		return nil
+	}
+	ca, err := ParseCPUList(a)
+	if err != nil {
+		return err
+	}
+	cb, err := ParseCPUList(b)
+	if err != nil {
+		return err
+	}
+	set := make(map[int]bool, len(ca))
+	for _, c := range ca {
+		set[c] = true
+	}
+	for _, c := range cb {
+		if set[c] {
+			return errCPUsOverlap.New(a, b)
+		}
+	}
+	return nil
+}
+
+// PinProcess pins all threads of the current process to a given list of CPUs, threads created afterwards inherit it
+func PinProcess(list string) error {
+	cpus, err := ParseCPUList(list)
+	if err != nil {
+		return err
+	}
+	if err := setAffinity(cpus); err != nil {
+		return errPinFailed.New(list, err)
+	}
+	clientCPUSet = list
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package performance
+
+import "gopkg.in/src-d/go-errors.v1"
+
+var errAffinityNotSupported = errors.NewKind("CPU affinity is supported only on linux")
+
+func setAffinity(cpus []int) error {
+	return errAffinityNotSupported.New()
+}
@@ -0,0 +1,186 @@
+package coldstart
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bblfsh/performance"
+	"github.com/bblfsh/performance/docker"
+	helper "github.com/bblfsh/performance/grpc-helper"
+	"github.com/bblfsh/performance/storage"
+	"github.com/bblfsh/performance/storage/file"
+	"github.com/bblfsh/performance/storage/influxdb"
+	"github.com/bblfsh/performance/storage/pushgateway"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/tools/benchmark/parse"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+var errInvalidRuns = errors.NewKind("amount of runs should be positive, got %v")
+
+// Cmd return configured cold-start command
+func Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "cold-start [--target=<target>] [--language=<language>] [--commit=<commit-id>] [--docker-tag=<docker-tag>] [--runs=<runs>] [--storage=<storage>] <file>",
+		Aliases: []string{"cs"},
+		Args:    cobra.ExactArgs(1),
+		Short:   "repeatedly run fresh driver or bblfshd container and measure the time till the first successful parse, store results into a given storage",
+		Example: `WARNING! To access storage corresponding environment variables should be set.
+Full examples of usage scripts are following:
+
+# for language driver container and prometheus pushgateway
+export PROM_ADDRESS="localhost:9091"
+export PROM_JOB=pushgateway
+./bblfsh-performance cold-start \
+--target=driver \
+--language=go \
+--commit=096361d09049c27e829fd5a6658f1914fd3b62ac \
+--runs=10 \
+/var/testdata/fixtures/bench_accumulator_factory.go
+
+# for bblfshd container and influx db
+export INFLUX_ADDRESS="http://localhost:8086"
+export INFLUX_USERNAME=""
+export INFLUX_PASSWORD=""
+export INFLUX_DB=mydb
+export INFLUX_MEASUREMENT=benchmark
+./bblfsh-performance cold-start \
+--target=bblfshd \
+--language=go \
+--docker-tag=latest-drivers \
+--runs=10 \
+--storage=influxdb \
+/var/testdata/fixtures/bench_accumulator_factory.go`,
+		RunE: performance.RunESilenced(func(cmd *cobra.Command, args []string) error {
+			// prepare context
+			maxDuration, _ := cmd.Flags().GetDuration(performance.MaxDurationFlag)
+			ctx, cancel := performance.NewContext(maxDuration)
+			defer cancel()
+
+			targetKind, _ := cmd.Flags().GetString("target")
+			language, _ := cmd.Flags().GetString("language")
+			commit, _ := cmd.Flags().GetString("commit")
+			tag, _ := cmd.Flags().GetString("docker-tag")
+			runs, _ := cmd.Flags().GetInt("runs")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			stor, _ := cmd.Flags().GetString("storage")
+			filterPrefix, _ := cmd.Flags().GetString("filter-prefix")
+
+			if _, err := storage.ValidateKind(stor); err != nil {
+				return err
+			}
+			if runs <= 0 {
+				return errInvalidRuns.New(runs)
+			}
+
+			fixture, err := performance.ReadFixture(args[0])
+			if err != nil {
+				return err
+			}
+
+			target, err := docker.NewTarget(targetKind, language, commit, tag)
+			if err != nil {
+				return err
+			}
+
+			bench, env, err := benchColdStart(ctx, target, runs, timeout, language, fixture, filterPrefix)
+			if err != nil {
+				return err
+			}
+
+			// store data
+			storageClient, err := storage.NewClient(stor)
+			if err != nil {
+				return err
+			}
+			defer storageClient.Close()
+
+			// the run is partial if it was interrupted before all the containers were started
+			partial := bench.Benchmark.N < runs
+			return storageClient.Dump(performance.PartialTags(partial, performance.MergeTags(map[string]string{
+				"language": language,
+				"commit":   commit,
+				"level":    target.ColdStartLevel(),
+			}, performance.Environment(), env)), storage.WithHostMetrics([]performance.Benchmark{bench})...)
+		}),
+	}
+
+	flags := cmd.Flags()
+	flags.String("target", docker.TargetDriver, "container to be started("+docker.TargetDriver+", "+docker.TargetBblfshd+")")
+	flags.StringP("language", "l", "", "name of the language to be tested")
+	flags.StringP("commit", "c", "", "commit id that's being tested and will be used as a tag in performance report")
+	flags.StringP("docker-tag", "t", docker.BblfshdDefaultTag, "bblfshd docker image tag to be tested")
+	flags.IntP("runs", "r", 5, "amount of fresh containers to be started")
+	flags.Duration("timeout", 5*time.Minute, "maximal time to wait for the first successful parse")
+	flags.String("filter-prefix", performance.FileFilterPrefix, "file prefix to be trimmed from the name of result")
+	flags.StringP("storage", "s", pushgateway.Kind, fmt.Sprintf("storage kind to store the results(%s, %s, %s)", pushgateway.Kind, influxdb.Kind, file.Kind))
+
+	return cmd
+}
+
+// benchColdStart starts fresh container of a given target a given amount of times and measures the time from
+// the container start according to the docker daemon till its port accepts connections and till the first
+// successful parse of a given fixture. Docker environment is the same for all runs, so it's returned for the first
+// container only. If the context is cancelled, only the completed runs are measured
+func benchColdStart(ctx context.Context, target *docker.Target, runs int, timeout time.Duration, language string,
+	fixture *performance.Fixture, trimPrefix string) (performance.Benchmark, map[string]string, error) {
+	var (
+		portTotal, total time.Duration
+		min, max         time.Duration
+		env              map[string]string
+	)
+	var done int
+	for i := 0; i < runs && ctx.Err() == nil; i++ {
+		log.Debugf("cold start run %d of %d", i+1, runs)
+		container, err := target.Start()
+		if err != nil {
+			return performance.Benchmark{}, nil, err
+		}
+		port := time.Since(container.Started)
+
+		rctx, cancel := context.WithTimeout(ctx, timeout)
+		d, err := helper.WaitFirstParse(rctx, container.Address, language, fixture, container.Started)
+		cancel()
+		if env == nil {
+			// it's taken after the first parse, so the docker requests are not measured
+			env = container.Environment()
+		}
+		container.Close()
+		if err != nil && ctx.Err() != nil {
+			log.Warningf("cold start run %d was interrupted", i+1)
+			break
+		} else if err != nil {
+			return performance.Benchmark{}, nil, err
+		}
+		log.Debugf("port is ready in %v, first parse in %v", port, d)
+
+		portTotal += port
+		total += d
+		if i == 0 || d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+		done++
+	}
+	if done == 0 {
+		return performance.Benchmark{}, nil, ctx.Err()
+	}
+
+	// only the time is measured, so allocations are not stored
+	bench := performance.NewBenchmark(&parse.Benchmark{
+		Name:     fixture.Path,
+		N:        done,
+		NsPerOp:  float64(total.Nanoseconds()) / float64(done),
+		Measured: parse.NsPerOp,
+	}, trimPrefix)
+	bench.SetTag(performance.FixtureHashTag, fixture.Hash)
+	bench.SetMetric(storage.ColdStartPortSeconds, (portTotal / time.Duration(done)).Seconds())
+	bench.SetMetric(storage.ColdStartMinSeconds, min.Seconds())
+	bench.SetMetric(storage.ColdStartMaxSeconds, max.Seconds())
+	return bench, env, nil
+}
@@ -1,10 +1,7 @@
 package driver
 
 import (
-	"context"
 	"fmt"
-	"os"
-	"os/signal"
 
 	"github.com/bblfsh/performance"
 	"github.com/bblfsh/performance/docker"
@@ -15,9 +12,12 @@ import (
 	"github.com/bblfsh/performance/storage/pushgateway"
 
 	"github.com/spf13/cobra"
+	"gopkg.in/src-d/go-errors.v1"
 	"gopkg.in/src-d/go-log.v1"
 )
 
+var errNoPprofPort = errors.NewKind("--pprof-port is required to capture profiles of the driver")
+
 // Cmd return configured driver-native command
 func Cmd() *cobra.Command {
 	cmd := &cobra.Command{
@@ -47,17 +47,56 @@ export INFLUX_MEASUREMENT=benchmark
 --commit 096361d09049c27e829fd5a6658f1914fd3b62ac \
 --storage=influxdb \
 /var/testdata/fixtures
+
+# for concurrency sweep that detects the saturation point
+./bblfsh-performance driver \
+--language go \
+--sweep \
+--max-concurrency=64 \
+--step-duration=1m \
+--storage=influxdb \
+/var/testdata/fixtures
+
+# for cpu and heap profiles of Go driver that serves net/http/pprof on port 6060
+./bblfsh-performance driver \
+--language go \
+--pprof-port=6060 \
+--profile=cpu,heap \
+--profile-dir=./profiles \
+/var/testdata/fixtures
 `,
 		RunE: performance.RunESilenced(func(cmd *cobra.Command, args []string) error {
+			// prepare context
+			maxDuration, _ := cmd.Flags().GetDuration(performance.MaxDurationFlag)
+			ctx, cancel := performance.NewContext(maxDuration)
+			defer cancel()
+
 			language, _ := cmd.Flags().GetString("language")
 			commit, _ := cmd.Flags().GetString("commit")
 			excludeSubstrings, _ := cmd.Flags().GetStringSlice("exclude-suffixes")
 			stor, _ := cmd.Flags().GetString("storage")
 			filterPrefix, _ := cmd.Flags().GetString("filter-prefix")
+			pprofPort, _ := cmd.Flags().GetString("pprof-port")
+			profiles, _ := cmd.Flags().GetStringSlice("profile")
+			profileDir, _ := cmd.Flags().GetString("profile-dir")
 
 			if _, err := storage.ValidateKind(stor); err != nil {
 				return err
 			}
+			if err := performance.ValidateProfiles(profiles); err != nil {
+				return err
+			}
+			var ports []string
+			if len(profiles) > 0 {
+				if pprofPort == "" {
+					return errNoPprofPort.New()
+				}
+				ports = append(ports, pprofPort)
+			}
+			sweep, isSweep, err := helper.ParseSweepFlags(cmd)
+			if err != nil {
+				return err
+			}
 
 			log.Debugf("download and build driver")
 			image, err := docker.DownloadAndBuildDriver(language, commit)
@@ -66,29 +105,13 @@ export INFLUX_MEASUREMENT=benchmark
 			}
 
 			log.Debugf("run driver container")
-			driver, err := docker.RunDriver(image)
+			driver, err := docker.RunDriverWithPorts(image, ports)
 			if err != nil {
 				return err
 			}
 			defer driver.Close()
 
-			// prepare context
-			ctx, cancel := context.WithCancel(context.Background())
-			c := make(chan os.Signal, 1)
-			signal.Notify(c, os.Interrupt)
-			defer func() {
-				signal.Stop(c)
-				cancel()
-			}()
-			go func() {
-				select {
-				case <-c:
-					cancel()
-				case <-ctx.Done():
-				}
-			}()
-
-			return helper.BenchmarkGRPCAndStore(ctx, helper.BenchmarkGRPCMeta{
+			meta := helper.BenchmarkGRPCMeta{
 				Address:           driver.Address,
 				Commit:            commit,
 				ExcludeSubstrings: excludeSubstrings,
@@ -97,7 +120,26 @@ export INFLUX_MEASUREMENT=benchmark
 				Language:          language,
 				Level:             performance.DriverLevel,
 				Storage:           stor,
-			})
+				Environment:       performance.MergeTags(performance.Environment(), driver.Environment(), performance.ProfileTags(profiles)),
+			}
+			meta.ParseFlags(cmd)
+
+			sampler := driver.StartSampler(ctx)
+			defer sampler.Stop()
+			meta.Resources = sampler
+			meta.CPU = driver
+			if len(profiles) > 0 {
+				meta.Profiler, err = helper.NewPprofProfiler(driver.HostAddress(pprofPort), profileDir, profiles)
+				if err != nil {
+					return err
+				}
+			}
+
+			if isSweep {
+				return helper.BenchmarkSweepAndStore(ctx, meta, sweep)
+			}
+
+			return helper.BenchmarkGRPCAndStore(ctx, meta)
 		}),
 	}
 
@@ -107,6 +149,11 @@ export INFLUX_MEASUREMENT=benchmark
 	flags.StringSlice("exclude-suffixes", []string{".legacy", ".native", ".uast"}, "file suffixes to be excluded")
 	flags.String("filter-prefix", performance.FileFilterPrefix, "file prefix to be filtered")
 	flags.StringP("storage", "s", pushgateway.Kind, fmt.Sprintf("storage kind to store the results(%s, %s, %s)", pushgateway.Kind, influxdb.Kind, file.Kind))
+	flags.String("pprof-port", "", "container port of the net/http/pprof endpoint of Go driver, required for profiling")
+	flags.StringSlice("profile", nil, "kinds of pprof profiles of the driver to capture per file: cpu, heap, allocs, mutex, they are captured after the benchmark of the file while its requests are replayed for the duration of the benchmark")
+	flags.String("profile-dir", "profiles", "directory to store pprof profiles")
+	helper.AddFlags(cmd)
+	helper.AddSweepFlags(cmd)
 
 	return cmd
 }
@@ -4,9 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
-	"os/signal"
 	"path/filepath"
+	"strings"
 
 	"github.com/bblfsh/performance"
 	"github.com/bblfsh/performance/docker"
@@ -57,22 +56,56 @@ export INFLUX_MEASUREMENT=benchmark
 --native /home/lwsanty/goproj/lwsanty/performance/cmd/native-driver-performance/native-driver-performance \
 --storage=influxdb \
 /var/testdata/fixtures
+
+# for cpu and heap profiles of native driver per fixture
+./bblfsh-performance driver-native \
+--language go \
+--native /home/lwsanty/goproj/lwsanty/performance/cmd/native-driver-performance/native-driver-performance \
+--profile=cpu,heap \
+--profile-dir=./profiles \
+/var/testdata/fixtures
 `,
 		RunE: performance.RunESilenced(func(cmd *cobra.Command, args []string) error {
+			// prepare context
+			maxDuration, _ := cmd.Flags().GetDuration(performance.MaxDurationFlag)
+			ctx, cancel := performance.NewContext(maxDuration)
+			defer cancel()
+
 			language, _ := cmd.Flags().GetString("language")
 			commit, _ := cmd.Flags().GetString("commit")
 			stor, _ := cmd.Flags().GetString("storage")
 			filterPrefix, _ := cmd.Flags().GetString("filter-prefix")
 			native, _ := cmd.Flags().GetString("native")
+			failFast, _ := cmd.Flags().GetBool("fail-fast")
+			excludeSubstrings, _ := cmd.Flags().GetStringSlice("exclude-suffixes")
+			fingerprintFile, _ := cmd.Flags().GetString("fingerprint-file")
+			profiles, _ := cmd.Flags().GetStringSlice("profile")
+			profileDir, _ := cmd.Flags().GetString("profile-dir")
 
 			fixtures := args[0]
 			execDst := getSubTmp(filepath.Base(native))
 			resultsPath := getSubTmp(results)
+			profilePath := getSubTmp(filepath.Base(profileDir))
 
 			log.Debugf("validating storage")
 			if _, err := storage.ValidateKind(stor); err != nil {
 				return err
 			}
+			if err := performance.ValidateProfiles(profiles); err != nil {
+				return err
+			}
+
+			files, err := performance.GetFiles(filterPrefix, excludeSubstrings, fixtures)
+			if err != nil {
+				return err
+			}
+			fingerprint, err := performance.NewFingerprint(files)
+			if err != nil {
+				return err
+			}
+			if err := performance.CheckFingerprint(fingerprintFile, fingerprint); err != nil {
+				return err
+			}
 
 			log.Debugf("download and build driver")
 			image, err := docker.DownloadAndBuildDriver(language, commit)
@@ -87,49 +120,107 @@ export INFLUX_MEASUREMENT=benchmark
 			}
 			defer driver.Close()
 
-			// prepare context
-			ctx, cancel := context.WithCancel(context.Background())
-			c := make(chan os.Signal, 1)
-			signal.Notify(c, os.Interrupt)
-			defer func() {
-				signal.Stop(c)
-				cancel()
-			}()
-			go func() {
-				select {
-				case <-c:
-					cancel()
-				case <-ctx.Done():
-				}
-			}()
-
 			log.Debugf("copying file %v to container's dst: %v", native, execDst)
 			if err := driver.Upload(ctx, native, execDst); err != nil {
 				return err
 			}
 
 			log.Debugf("executing command on driver")
-			//if err := driver.Exec(ctx, "sh", "-c", "dfgdfg"); err != nil {
-			if err := driver.Exec(ctx,
-				[]string{"LOG_LEVEL=debug"},
+			// native util is interrupted explicitly, so it discards the current file and writes completed results
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				select {
+				case <-ctx.Done():
+					log.Debugf("interrupting %v", execDst)
+					if err := driver.Interrupt(context.Background(), execDst); err != nil {
+						log.Errorf(err, "cannot interrupt %v", execDst)
+					}
+				case <-done:
+				}
+			}()
+			// resource usage is aggregated per file, the periods are separated by progress events of native util
+			sampler := driver.StartSampler(ctx)
+			defer sampler.Stop()
+			var (
+				current   string
+				resources = make(map[string]performance.ResourceStats)
+			)
+			progress := performance.NewProgress(len(files))
+			update := func(e performance.ProgressEvent) {
+				progress.Update(e)
+				if e.Current == current {
+					return
+				}
+				if current != "" {
+					resources[performance.ParseBenchmarkName(current, filterPrefix)] = sampler.Collect()
+				}
+				// it's called from the output stream of native util, so it should not block
+				sampler.Mark()
+				current = e.Current
+			}
+			execArgs := []string{
 				execDst,
-				"--filter-prefix="+filterPrefix,
-				"--fixtures="+containerFixtures,
-				"--results="+resultsPath,
-			); err != nil {
+				"--filter-prefix=" + filterPrefix,
+				// the same files are benchmarked as the ones fingerprinted
+				"--exclude-suffixes=" + strings.Join(excludeSubstrings, ","),
+				"--fixtures=" + containerFixtures,
+				"--results=" + resultsPath,
+				fmt.Sprintf("--fail-fast=%t", failFast),
+			}
+			if len(profiles) > 0 {
+				execArgs = append(execArgs,
+					"--profile="+strings.Join(profiles, ","),
+					"--profile-dir="+profilePath,
+				)
+			}
+			endNative := performance.Trace(performance.TraceCategoryPhase, "native benchmarks", nil)
+			relay := performance.NewProgressRelay(progress, update)
+			err = driver.ExecStream(context.Background(), relay, []string{"LOG_LEVEL=debug"}, execArgs...)
+			if ferr := relay.Flush(); ferr != nil {
+				log.Warningf("cannot write output of %v: %v", execDst, ferr)
+			}
+			progress.Finish()
+			endNative()
+			if err != nil {
 				return err
 			}
 
+			if len(profiles) > 0 {
+				log.Debugf("copying profiles to %v", profileDir)
+				if err := driver.Download(context.Background(), profilePath, filepath.Dir(profileDir)); err != nil {
+					return err
+				}
+			}
+
 			log.Debugf("getting results")
-			data, err := driver.GetResults(ctx, resultsPath)
+			data, err := driver.GetResults(context.Background(), resultsPath)
 			if err != nil {
 				return err
 			}
 
-			var benchmarks []performance.Benchmark
-			if err := json.Unmarshal(data, &benchmarks); err != nil {
+			var report performance.Report
+			if err := json.Unmarshal(data, &report); err != nil {
 				return err
 			}
+			for i, b := range report.Benchmarks {
+				if !b.Failed() {
+					storage.SetResourceMetrics(&report.Benchmarks[i], resources[b.Benchmark.Name])
+				}
+			}
+
+			tags := performance.MergeTags(map[string]string{
+				"language": language,
+				"commit":   commit,
+				"level":    performance.DriverNativeLevel,
+
+				performance.CorpusHashTag: fingerprint.Corpus,
+			}, performance.Environment(), driver.Environment(), performance.ProfileTags(profiles),
+				performance.PrefixTags(performance.ContainerTagPrefix, report.Environment))
+			if report.Partial {
+				log.Warningf("native benchmarks were interrupted, storing partial results")
+				tags[performance.PartialTag] = "true"
+			}
 
 			// store data
 			storageClient, err := storage.NewClient(stor)
@@ -138,15 +229,13 @@ export INFLUX_MEASUREMENT=benchmark
 			}
 			defer storageClient.Close()
 
-			if err := storageClient.Dump(map[string]string{
-				"language": language,
-				"commit":   commit,
-				"level":    performance.DriverNativeLevel,
-			}, benchmarks...); err != nil {
+			if err := storageClient.Dump(tags, storage.WithHostMetrics(report.Benchmarks)...); err != nil {
 				return err
 			}
-
-			return nil
+			if report.Partial {
+				return nil
+			}
+			return performance.SaveFingerprint(fingerprintFile, fingerprint)
 		}),
 	}
 
@@ -156,6 +245,10 @@ export INFLUX_MEASUREMENT=benchmark
 	flags.StringP("commit", "c", "", "commit id that's being tested and will be used as a tag in performance report")
 	flags.StringSlice("exclude-suffixes", []string{".legacy", ".native", ".uast"}, "file suffixes to be excluded")
 	flags.String("filter-prefix", performance.FileFilterPrefix, "file prefix to be filtered")
+	flags.Bool("fail-fast", false, "stop on the first failed file instead of storing its error and proceeding")
+	flags.String("fingerprint-file", "", "file to keep fixtures fingerprint between runs, warns if fixtures have changed since the previous run")
+	flags.StringSlice("profile", nil, "kinds of pprof profiles of native driver to write per fixture: cpu, heap, allocs, mutex")
+	flags.String("profile-dir", "profiles", "directory to copy pprof profiles to")
 	flags.StringP("storage", "s", pushgateway.Kind, fmt.Sprintf("storage kind to store the results(%s, %s, %s)", pushgateway.Kind, influxdb.Kind, file.Kind))
 
 	return cmd
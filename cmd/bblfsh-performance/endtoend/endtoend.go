@@ -1,10 +1,9 @@
 package endtoend
 
 import (
-	"context"
 	"fmt"
 	"os"
-	"os/signal"
+	"time"
 
 	"github.com/bblfsh/performance"
 	"github.com/bblfsh/performance/docker"
@@ -15,10 +14,17 @@ import (
 	"github.com/bblfsh/performance/storage/pushgateway"
 
 	"github.com/spf13/cobra"
+	"gopkg.in/src-d/go-errors.v1"
 	"gopkg.in/src-d/go-log.v1"
 )
 
-const bblfshDefaultConfTag = "latest-drivers"
+const (
+	bblfshDefaultConfTag = "latest-drivers"
+	// bblfshdMetricsPrefix is a prefix of bblfshd own metrics, the rest of metrics describe Go runtime and the endpoint
+	bblfshdMetricsPrefix = "bblfshd_"
+)
+
+var errSweepMixed = errors.NewKind("--sweep cannot be combined with --mixed")
 
 // TODO(lwsanty): https://github.com/bblfsh/performance/issues/2
 // Cmd return configured end to end command
@@ -26,8 +32,13 @@ func Cmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "end-to-end [--language=<language>] [--commit=<commit-id>] [--docker-tag=<docker-tag>] [--storage=<storage>] <directory ...>",
 		Aliases: []string{"e2e"},
-		Args:    cobra.MinimumNArgs(1),
-		Short:   "run bblfshd container and perform benchmark tests, store results into a given storage",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if dirs, _ := cmd.Flags().GetStringToString("language-dirs"); len(dirs) > 0 {
+				return nil
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
+		Short: "run bblfshd container and perform benchmark tests, store results into a given storage",
 		Example: `To use external bblfshd set BBLFSHD_LOCAL=${bblfshd_address}
 
 WARNING! To access storage corresponding environment variables should be set.
@@ -54,20 +65,44 @@ export INFLUX_MEASUREMENT=benchmark
 --commit=096361d09049c27e829fd5a6658f1914fd3b62ac \
 --filter-prefix="bench_" \
 --storage="influxdb" \
-/var/testdata/benchmarks`,
+/var/testdata/benchmarks
+
+# for mixed workload of several languages replayed by concurrent clients
+./bblfsh-performance end-to-end \
+--mixed \
+--language-dirs=go=/var/testdata/go,python=/var/testdata/python \
+--weights=go=3,python=1 \
+--concurrency=8 \
+--duration=5m \
+--storage="influxdb"`,
 		RunE: performance.RunESilenced(func(cmd *cobra.Command, args []string) error {
+			// prepare context
+			maxDuration, _ := cmd.Flags().GetDuration(performance.MaxDurationFlag)
+			ctx, cancel := performance.NewContext(maxDuration)
+			defer cancel()
+
 			language, _ := cmd.Flags().GetString("language")
 			commit, _ := cmd.Flags().GetString("commit")
 			excludeSubstrings, _ := cmd.Flags().GetStringSlice("exclude-suffixes")
 			stor, _ := cmd.Flags().GetString("storage")
 			filterPrefix, _ := cmd.Flags().GetString("filter-prefix")
 			customDriver, _ := cmd.Flags().GetBool("custom-driver")
+			metricsAddress, _ := cmd.Flags().GetString("metrics-address")
+			mixed, _ := cmd.Flags().GetBool("mixed")
 
 			if _, err := storage.ValidateKind(stor); err != nil {
 				return err
 			}
+			sweep, isSweep, err := helper.ParseSweepFlags(cmd)
+			if err != nil {
+				return err
+			}
+			if isSweep && mixed {
+				return errSweepMixed.New()
+			}
 
 			// for debug purposes with externally spinning container
+			var container *docker.Driver
 			containerAddress := os.Getenv("BBLFSHD_LOCAL")
 			if containerAddress == "" {
 				tag, _ := cmd.Flags().GetString("docker-tag")
@@ -76,12 +111,16 @@ export INFLUX_MEASUREMENT=benchmark
 					return performance.ErrCannotInstallCustomDriver.New("bblfshd tag is set to " + bblfshDefaultConfTag + ": all drivers are pre-installed")
 				}
 
-				addr, closer, err := docker.RunBblfshd(tag)
+				bblfshd, err := docker.StartBblfshd(tag)
 				if err != nil {
 					return err
 				}
-				defer closer()
-				containerAddress = addr
+				defer bblfshd.Close()
+				containerAddress = bblfshd.Address
+				container = bblfshd
+				if metricsAddress == "" {
+					metricsAddress = bblfshd.HostAddress(docker.BblfshdMetricsPort)
+				}
 
 				if customDriver {
 					if err := docker.InstallDriver(language, commit); err != nil {
@@ -90,23 +129,7 @@ export INFLUX_MEASUREMENT=benchmark
 				}
 			}
 
-			// prepare context
-			ctx, cancel := context.WithCancel(context.Background())
-			c := make(chan os.Signal, 1)
-			signal.Notify(c, os.Interrupt)
-			defer func() {
-				signal.Stop(c)
-				cancel()
-			}()
-			go func() {
-				select {
-				case <-c:
-					cancel()
-				case <-ctx.Done():
-				}
-			}()
-
-			return helper.BenchmarkGRPCAndStore(ctx, helper.BenchmarkGRPCMeta{
+			meta := helper.BenchmarkGRPCMeta{
 				Address:           containerAddress,
 				Commit:            commit,
 				ExcludeSubstrings: excludeSubstrings,
@@ -115,7 +138,46 @@ export INFLUX_MEASUREMENT=benchmark
 				Language:          language,
 				Level:             performance.BblfshdLevel,
 				Storage:           stor,
-			})
+			}
+			meta.ParseFlags(cmd)
+			meta.DetectLanguage, _ = cmd.Flags().GetBool("detect-language")
+			meta.Environment = performance.Environment()
+			// environment, resources and CPU of external bblfshd are not measured
+			if container != nil {
+				meta.Environment = performance.MergeTags(meta.Environment, container.Environment())
+				sampler := container.StartSampler(ctx)
+				defer sampler.Stop()
+				meta.Resources = sampler
+				meta.CPU = container
+			}
+
+			if metricsAddress != "" {
+				scraper := helper.PrometheusScraper{URL: "http://" + metricsAddress + "/metrics", Prefix: bblfshdMetricsPrefix}
+				if _, err := scraper.Scrape(ctx); err != nil {
+					log.Warningf("bblfshd metrics are not stored: %v", err)
+				} else {
+					meta.ServerMetrics = scraper
+				}
+			}
+
+			if isSweep {
+				return helper.BenchmarkSweepAndStore(ctx, meta, sweep)
+			}
+
+			if mixed {
+				languageDirs, _ := cmd.Flags().GetStringToString("language-dirs")
+				weights, _ := cmd.Flags().GetStringToInt("weights")
+				concurrency, _ := cmd.Flags().GetInt("concurrency")
+				duration, _ := cmd.Flags().GetDuration("duration")
+				return helper.BenchmarkWorkloadAndStore(ctx, meta, helper.Workload{
+					LanguageDirs: languageDirs,
+					Weights:      weights,
+					Concurrency:  concurrency,
+					Duration:     duration,
+				})
+			}
+
+			return helper.BenchmarkGRPCAndStore(ctx, meta)
 		}),
 	}
 
@@ -128,6 +190,15 @@ export INFLUX_MEASUREMENT=benchmark
 	flags.StringP("storage", "s", pushgateway.Kind, "storage kind to store the results"+
 		fmt.Sprintf("(%s, %s, %s)", pushgateway.Kind, influxdb.Kind, file.Kind))
 	flags.Bool("custom-driver", false, "if this flag is set to true CLI pulls corresponding language driver repo's commit, builds docker image and installs it onto the bblfsh container")
+	flags.String("metrics-address", "", "host:port of bblfshd Prometheus endpoint, changes of its cumulative metrics are stored per operation and gauges before and after the benchmark, by default the endpoint of started bblfshd container is used")
+	flags.Bool("detect-language", false, "additionally benchmark each file sending only its filename, so bblfshd has to detect the language, and store the detection overhead")
+	flags.Bool("mixed", false, "replay a weighted mix of requests of several languages instead of benchmarking files one by one, cannot be combined with --modes, --compression, --detect-language and --sweep")
+	flags.StringToString("language-dirs", nil, "directories with fixtures per language for mixed workload, if not set languages are detected by file extensions")
+	flags.StringToInt("weights", nil, "relative shares of requests per language for mixed workload, languages without weight get 1, zero weight excludes the language")
+	flags.Int("concurrency", 4, "amount of concurrent clients for mixed workload")
+	flags.Duration("duration", time.Minute, "duration of mixed workload")
+	helper.AddFlags(cmd)
+	helper.AddSweepFlags(cmd)
 
 	return cmd
 }
@@ -4,31 +4,125 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/bblfsh/performance"
+	"github.com/bblfsh/performance/cmd/bblfsh-performance/coldstart"
 	"github.com/bblfsh/performance/cmd/bblfsh-performance/driver"
 	"github.com/bblfsh/performance/cmd/bblfsh-performance/drivernative"
 	"github.com/bblfsh/performance/cmd/bblfsh-performance/endtoend"
 	"github.com/bblfsh/performance/cmd/bblfsh-performance/parseandstore"
+	"github.com/bblfsh/performance/cmd/bblfsh-performance/soak"
+	"github.com/bblfsh/performance/docker"
 	_ "github.com/bblfsh/performance/storage/file"
 	_ "github.com/bblfsh/performance/storage/influxdb"
 	_ "github.com/bblfsh/performance/storage/pushgateway"
 
 	"github.com/spf13/cobra"
+	"gopkg.in/src-d/go-log.v1"
 )
 
+// version is set by the build, see src-d/ci Makefile
+var version = "undefined"
+
 func main() {
+	performance.Version = version
+
 	var rootCmd = &cobra.Command{
 		Use:     "bblfsh-performance",
 		Aliases: []string{"bblfsh-perf"},
 		Short:   "Performance test utilities for bblfshd and drivers",
+		PersistentPreRunE: performance.RunESilenced(func(cmd *cobra.Command, args []string) error {
+			startTrace(cmd)
+			if err := checkHost(cmd); err != nil {
+				return err
+			}
+			return applyLimits(cmd)
+		}),
 	}
 
+	flags := rootCmd.PersistentFlags()
+	flags.Duration(performance.MaxDurationFlag, 0, "maximal duration of the command, after it passes benchmarks are stopped and completed results are stored marked as partial, 0 means no limit")
+	flags.String("cpuset", "", "CPUs to pin the benchmarked container to, e.g. 2-3")
+	flags.Float64("cpus", 0, "CPU quota of the benchmarked container in cores, 0 means no quota")
+	flags.Int64("memory-mb", 0, "memory limit of the benchmarked container in megabytes, 0 means no limit")
+	flags.String("client-cpuset", "", "CPUs to pin the benchmarking client to, should not overlap with --cpuset")
+	flags.Bool("strict", false, "abort if the host is not quiet enough for benchmarks instead of warning")
+	flags.Float64("max-load", 0.3, "maximal 1-minute load average per CPU core that is considered quiet")
+	flags.Bool("skip-host-check", false, "do not check if the host is quiet enough for benchmarks")
+	flags.StringVar(&tracePath, "trace", "", "file to write the timeline of the run to in Chrome trace-event format, it can be viewed in chrome://tracing or Perfetto")
+	flags.Int("trace-sample", 100, "trace every n-th request")
+
 	rootCmd.AddCommand(
 		parseandstore.Cmd(),
 		drivernative.Cmd(),
 		driver.Cmd(),
-		endtoend.Cmd())
-	if err := rootCmd.Execute(); err != nil {
+		endtoend.Cmd(),
+		coldstart.Cmd(),
+		soak.Cmd())
+	err := rootCmd.Execute()
+	if endTrace != nil {
+		endTrace()
+		if err := performance.WriteTrace(tracePath); err != nil {
+			log.Errorf(err, "cannot write trace to %s", tracePath)
+		}
+	}
+	if err != nil {
 		fmt.Println("Error:", err)
 		os.Exit(1)
 	}
 }
+
+var (
+	tracePath string
+	// endTrace ends the span of the whole run if tracing is enabled
+	endTrace func()
+)
+
+// startTrace enables tracing of the run if the trace file is set
+func startTrace(cmd *cobra.Command) {
+	if tracePath == "" {
+		return
+	}
+	sample, _ := cmd.Flags().GetInt("trace-sample")
+	performance.StartTrace(sample)
+	endTrace = performance.Trace(performance.TraceCategoryPhase, cmd.Name(), nil)
+}
+
+// checkHost checks if the host is quiet enough for benchmarks before they start, commands that
+// do not run benchmarks are skipped
+func checkHost(cmd *cobra.Command) error {
+	skip, _ := cmd.Flags().GetBool("skip-host-check")
+	if _, ok := cmd.Annotations[performance.SkipHostCheckAnnotation]; ok || skip {
+		return nil
+	}
+	defer performance.Trace(performance.TraceCategoryPhase, "host check", nil)()
+	strict, _ := cmd.Flags().GetBool("strict")
+	maxLoad, _ := cmd.Flags().GetFloat64("max-load")
+
+	// externally started bblfshd is the benchmarked container, so it's not counted
+	check, problems := performance.CheckHost(maxLoad, func() (int, error) {
+		return docker.RunningContainers(os.Getenv("BBLFSHD_LOCAL"))
+	})
+	log.Debugf("host check: %+v", check)
+	return performance.ReportHostCheck(problems, strict)
+}
+
+// applyLimits applies resource limits of containers and pins the client to CPUs according to the flags
+func applyLimits(cmd *cobra.Command) error {
+	var limits docker.Limits
+	limits.CPUSet, _ = cmd.Flags().GetString("cpuset")
+	limits.CPUs, _ = cmd.Flags().GetFloat64("cpus")
+	memory, _ := cmd.Flags().GetInt64("memory-mb")
+	limits.Memory = memory << 20
+	clientCPUSet, _ := cmd.Flags().GetString("client-cpuset")
+
+	if err := performance.CheckDisjointCPUs(limits.CPUSet, clientCPUSet); err != nil {
+		return err
+	}
+	if err := docker.SetLimits(limits); err != nil {
+		return err
+	}
+	if clientCPUSet != "" {
+		return performance.PinProcess(clientCPUSet)
+	}
+	return nil
+}
@@ -17,10 +17,12 @@ import (
 // Cmd return configured parse-and-store command
 func Cmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "parse-and-store [--language=<language>] [--commit=<commit-id>] [--storage=<storage>] <file ...>",
+		Use:     "parse-and-store [--language=<language>] [--commit=<commit-id>] [--storage=<storage>] [--fixtures=<directory>] <file ...>",
 		Aliases: []string{"pas", "parse-and-dump"},
 		Args:    cobra.MinimumNArgs(1),
 		Short:   "parse file(s) with golang benchmark output and store it into a given storage",
+		// benchmarks are run elsewhere
+		Annotations: map[string]string{performance.SkipHostCheckAnnotation: ""},
 		Example: `WARNING! To access storage corresponding environment variables should be set.
 Full examples of usage scripts are following:
 
@@ -35,12 +37,49 @@ export INFLUX_USERNAME=""
 export INFLUX_PASSWORD=""
 export INFLUX_DB=mydb
 export INFLUX_MEASUREMENT=benchmark
-bblfsh-performance parse-and-store --language=go --commit=3d9682b --storage="influxdb" /var/log/bench0 /var/log/bench1`,
+bblfsh-performance parse-and-store --language=go --commit=3d9682b --storage="influxdb" /var/log/bench0 /var/log/bench1
+
+# with throughput normalized by the size of fixtures
+bblfsh-performance parse-and-store --language=go --commit=3d9682b --fixtures=/var/testdata/fixtures /var/log/bench0`,
 		RunE: performance.RunESilenced(func(cmd *cobra.Command, args []string) error {
 			language, _ := cmd.Flags().GetString("language")
 			commit, _ := cmd.Flags().GetString("commit")
 			filterPrefix, _ := cmd.Flags().GetString("filter-prefix")
 			stor, _ := cmd.Flags().GetString("storage")
+			fixtureDirs, _ := cmd.Flags().GetStringSlice("fixtures")
+			excludeSubstrings, _ := cmd.Flags().GetStringSlice("exclude-suffixes")
+			fingerprintFile, _ := cmd.Flags().GetString("fingerprint-file")
+
+			// benchmarks are run elsewhere, so only the version of the tool describes this environment
+			tags := map[string]string{
+				"language": language,
+				"commit":   commit,
+				"level":    performance.TransformsLevel,
+
+				performance.ToolVersionTag: performance.Version,
+			}
+
+			var (
+				fixtures    map[string]*performance.Fixture
+				fingerprint *performance.Fingerprint
+			)
+			if len(fixtureDirs) > 0 {
+				files, err := performance.GetFiles(filterPrefix, excludeSubstrings, fixtureDirs...)
+				if err != nil {
+					return err
+				}
+				if fingerprint, err = performance.NewFingerprint(files); err != nil {
+					return err
+				}
+				if err := performance.CheckFingerprint(fingerprintFile, fingerprint); err != nil {
+					return err
+				}
+				tags[performance.CorpusHashTag] = fingerprint.Corpus
+
+				if fixtures, err = getFixtures(files, filterPrefix); err != nil {
+					return err
+				}
+			}
 
 			c, err := storage.NewClient(stor)
 			if err != nil {
@@ -50,20 +89,19 @@ bblfsh-performance parse-and-store --language=go --commit=3d9682b --storage="inf
 
 			// TODO(lwsanty): parallelize
 			for _, p := range args {
-				benchmarks, err := getBenchmarks(p, filterPrefix)
+				benchmarks, err := getBenchmarks(p, fixtures, filterPrefix)
 				if err != nil {
 					return err
 				}
-				if err := c.Dump(map[string]string{
-					"language": language,
-					"commit":   commit,
-					"level":    performance.TransformsLevel,
-				}, benchmarks...); err != nil {
+				if err := c.Dump(tags, benchmarks...); err != nil {
 					return err
 				}
 			}
 
-			return nil
+			if fingerprint == nil {
+				return nil
+			}
+			return performance.SaveFingerprint(fingerprintFile, fingerprint)
 		}),
 	}
 
@@ -72,13 +110,29 @@ bblfsh-performance parse-and-store --language=go --commit=3d9682b --storage="inf
 	flags.StringP("language", "l", "", "name of the language to be tested")
 	flags.StringP("commit", "c", "", "commit id that's being tested and will be used as a tag in performance report")
 	flags.String("filter-prefix", performance.FileFilterPrefix, "file prefix to be filtered")
+	flags.StringSlice("fixtures", nil, "directories with benchmarked fixtures, used to normalize results by fixture size")
+	flags.StringSlice("exclude-suffixes", []string{".legacy", ".native", ".uast"}, "fixture file suffixes to be excluded")
+	flags.String("fingerprint-file", "", "file to keep fixtures fingerprint between runs, warns if fixtures have changed since the previous run")
 	flags.StringP("storage", "s", pushgateway.Kind, "storage kind to store the results"+
 		fmt.Sprintf("(%s, %s, %s)", pushgateway.Kind, influxdb.Kind, file.Kind))
 
 	return cmd
 }
 
-func getBenchmarks(path string, trimPrefixes ...string) ([]performance.Benchmark, error) {
+// getFixtures reads given fixture files and maps them by the name of corresponding benchmark
+func getFixtures(files []string, filterPrefix string) (map[string]*performance.Fixture, error) {
+	fixtures := make(map[string]*performance.Fixture, len(files))
+	for _, f := range files {
+		fixture, err := performance.ReadFixture(f)
+		if err != nil {
+			return nil, err
+		}
+		fixtures[performance.ParseBenchmarkName(f, filterPrefix)] = fixture
+	}
+	return fixtures, nil
+}
+
+func getBenchmarks(path string, fixtures map[string]*performance.Fixture, trimPrefixes ...string) ([]performance.Benchmark, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -93,7 +147,13 @@ func getBenchmarks(path string, trimPrefixes ...string) ([]performance.Benchmark
 	for _, s := range set {
 		var benchmarkSet []performance.Benchmark
 		for _, b := range s {
-			benchmarkSet = append(benchmarkSet, performance.NewBenchmark(b, trimPrefixes...))
+			bench := performance.NewBenchmark(b, trimPrefixes...)
+			if f, ok := fixtures[bench.Benchmark.Name]; ok {
+				bench.Bytes = f.Bytes
+				bench.Lines = f.Lines
+				bench.SetTag(performance.FixtureHashTag, f.Hash)
+			}
+			benchmarkSet = append(benchmarkSet, bench)
 		}
 		result = append(result, benchmarkSet...)
 	}
@@ -0,0 +1,129 @@
+package soak
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bblfsh/performance"
+	"github.com/bblfsh/performance/docker"
+	helper "github.com/bblfsh/performance/grpc-helper"
+	"github.com/bblfsh/performance/storage"
+	"github.com/bblfsh/performance/storage/file"
+	"github.com/bblfsh/performance/storage/influxdb"
+	"github.com/bblfsh/performance/storage/pushgateway"
+
+	"github.com/spf13/cobra"
+)
+
+const megabyte = 1 << 20
+
+// Cmd return configured soak command
+func Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "soak [--target=<target>] [--language=<language>] [--commit=<commit-id>] [--docker-tag=<docker-tag>] [--duration=<duration>] [--storage=<storage>] <directory ...>",
+		Args:  cobra.MinimumNArgs(1),
+		Short: "run driver or bblfshd container and cycle through files for a long time, fail if container memory grows or latency drifts upward, store results into a given storage",
+		Example: `WARNING! To access storage corresponding environment variables should be set.
+Full examples of usage scripts are following:
+
+# for language driver container and prometheus pushgateway
+export PROM_ADDRESS="localhost:9091"
+export PROM_JOB=pushgateway
+./bblfsh-performance soak \
+--target=driver \
+--language=go \
+--commit=096361d09049c27e829fd5a6658f1914fd3b62ac \
+--duration=12h \
+/var/testdata/fixtures
+
+# for bblfshd container and influx db
+export INFLUX_ADDRESS="http://localhost:8086"
+export INFLUX_USERNAME=""
+export INFLUX_PASSWORD=""
+export INFLUX_DB=mydb
+export INFLUX_MEASUREMENT=benchmark
+./bblfsh-performance soak \
+--target=bblfshd \
+--language=go \
+--docker-tag=latest-drivers \
+--duration=24h \
+--max-memory-slope=5 \
+--storage=influxdb \
+/var/testdata/fixtures`,
+		RunE: performance.RunESilenced(func(cmd *cobra.Command, args []string) error {
+			// prepare context
+			maxDuration, _ := cmd.Flags().GetDuration(performance.MaxDurationFlag)
+			ctx, cancel := performance.NewContext(maxDuration)
+			defer cancel()
+
+			targetKind, _ := cmd.Flags().GetString("target")
+			language, _ := cmd.Flags().GetString("language")
+			commit, _ := cmd.Flags().GetString("commit")
+			tag, _ := cmd.Flags().GetString("docker-tag")
+			excludeSubstrings, _ := cmd.Flags().GetStringSlice("exclude-suffixes")
+			stor, _ := cmd.Flags().GetString("storage")
+			filterPrefix, _ := cmd.Flags().GetString("filter-prefix")
+
+			if _, err := storage.ValidateKind(stor); err != nil {
+				return err
+			}
+
+			target, err := docker.NewTarget(targetKind, language, commit, tag)
+			if err != nil {
+				return err
+			}
+			container, err := target.Start()
+			if err != nil {
+				return err
+			}
+			defer container.Close()
+
+			meta := helper.BenchmarkGRPCMeta{
+				Address:           container.Address,
+				Commit:            commit,
+				ExcludeSubstrings: excludeSubstrings,
+				Dirs:              args,
+				FilterPrefix:      filterPrefix,
+				Language:          language,
+				Level:             target.Level(),
+				Storage:           stor,
+				Environment:       performance.MergeTags(performance.Environment(), container.Environment()),
+			}
+			meta.ParseFlags(cmd)
+
+			soak := helper.Soak{
+				Memory: func(ctx context.Context) (uint64, error) {
+					return container.MemoryUsage(ctx)
+				},
+			}
+			soak.Duration, _ = cmd.Flags().GetDuration("duration")
+			soak.Interval, _ = cmd.Flags().GetDuration("interval")
+			soak.Settle, _ = cmd.Flags().GetDuration("settle")
+			soak.Concurrency, _ = cmd.Flags().GetInt("concurrency")
+			soak.MaxLatencyDrift, _ = cmd.Flags().GetFloat64("max-latency-drift")
+			maxMemorySlope, _ := cmd.Flags().GetFloat64("max-memory-slope")
+			soak.MaxMemorySlope = maxMemorySlope * megabyte
+
+			return helper.BenchmarkSoakAndStore(ctx, meta, soak)
+		}),
+	}
+
+	flags := cmd.Flags()
+	flags.String("target", docker.TargetDriver, "container to be tested("+docker.TargetDriver+", "+docker.TargetBblfshd+")")
+	flags.StringP("language", "l", "", "name of the language to be tested")
+	flags.StringP("commit", "c", "", "commit id that's being tested and will be used as a tag in performance report")
+	flags.StringP("docker-tag", "t", docker.BblfshdDefaultTag, "bblfshd docker image tag to be tested")
+	flags.StringSlice("exclude-suffixes", []string{".legacy", ".native", ".uast"}, "file suffixes to be excluded")
+	flags.String("filter-prefix", performance.FileFilterPrefix, "file prefix to be filtered")
+	flags.StringP("storage", "s", pushgateway.Kind, fmt.Sprintf("storage kind to store the results(%s, %s, %s)", pushgateway.Kind, influxdb.Kind, file.Kind))
+	flags.Duration("duration", 6*time.Hour, "total duration of the soak test")
+	flags.Duration("interval", time.Minute, "period of memory and latency sampling")
+	flags.Duration("settle", 10*time.Minute, "initial period, samples of which are not used to detect memory growth and latency drift")
+	flags.Int("concurrency", 1, "amount of concurrent clients")
+	flags.Float64("max-memory-slope", 10, "maximal allowed memory growth of the container in megabytes per hour")
+	flags.Float64("max-latency-drift", 1.5, "maximal allowed ratio of median latency at the end of the test to the one at the start")
+	helper.AddFlags(cmd)
+
+	return cmd
+}
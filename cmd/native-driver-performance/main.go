@@ -5,51 +5,61 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"os/signal"
-	"testing"
+	"path/filepath"
+	"strings"
 
 	"github.com/bblfsh/performance"
+	"github.com/bblfsh/performance/storage"
 
 	"github.com/bblfsh/sdk/v3/driver"
 	"github.com/bblfsh/sdk/v3/driver/native"
 	"gopkg.in/src-d/go-log.v1"
 )
 
-var excludeSubstrings = []string{".legacy", ".native", ".uast"}
+// version is set by the build, see src-d/ci Makefile
+var version = "undefined"
 
 func main() {
 	// TODO: fixtures filters and so on
 	fixtures := flag.String("fixtures", "", "path to fixtures directory")
 	resultsFile := flag.String("results", "", "path to file to store benchmark results")
 	filterPrefix := flag.String("filter-prefix", performance.FileFilterPrefix, "file prefix to be filtered")
+	excludeSuffixes := flag.String("exclude-suffixes", ".legacy,.native,.uast", "comma-separated file suffixes to be excluded")
+	failFast := flag.Bool("fail-fast", false, "stop on the first failed file instead of storing its error and proceeding")
+	profile := flag.String("profile", "", "comma-separated kinds of pprof profiles to write per fixture: cpu, heap, allocs, mutex")
+	profileDir := flag.String("profile-dir", "profiles", "path to directory to store pprof profiles")
 
 	flag.Parse()
+	performance.Version = version
 
 	// prepare context
-	ctx, cancel := context.WithCancel(context.Background())
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	defer func() {
-		signal.Stop(c)
-		cancel()
-	}()
-	go func() {
-		select {
-		case <-c:
-			cancel()
-		case <-ctx.Done():
+	ctx, cancel := performance.NewContext(0)
+	defer cancel()
+
+	var profiler *performance.Profiler
+	if *profile != "" {
+		var err error
+		profiler, err = performance.NewProfiler(*profileDir, strings.Split(*profile, ","))
+		if err != nil {
+			log.Infof("cannot start profiling: %v", err)
+			os.Exit(1)
 		}
-	}()
+	}
+
+	var exclude []string
+	if *excludeSuffixes != "" {
+		exclude = strings.Split(*excludeSuffixes, ",")
+	}
 
-	if err := run(ctx, *fixtures, *resultsFile, *filterPrefix); err != nil {
+	if err := run(ctx, *fixtures, *resultsFile, *filterPrefix, exclude, *failFast, profiler); err != nil {
 		log.Infof("run failed: %v", err)
 		os.Exit(1)
 	}
 }
 
-func run(ctx context.Context, fixtures, resultsFile, filterPrefix string) (gerr error) {
+func run(ctx context.Context, fixtures, resultsFile, filterPrefix string, excludeSubstrings []string, failFast bool,
+	profiler *performance.Profiler) (gerr error) {
 	client := native.NewDriver(native.UTF8)
 	if err := client.Start(); err != nil {
 		return fmt.Errorf("failed to start driver: %v", err)
@@ -64,16 +74,38 @@ func run(ctx context.Context, fixtures, resultsFile, filterPrefix string) (gerr
 	}
 
 	var benchmarks []performance.Benchmark
-	for _, f := range files {
+	for i, f := range files {
+		if ctx.Err() != nil {
+			break
+		}
+
 		log.Debugf("benching file: %s", f)
-		bRes, err := benchFile(ctx, client, f)
-		if err != nil {
-			return fmt.Errorf("cannot perform benchmark over the file %v: %v", f, err)
+		emitProgress(i, len(files), filepath.Base(f))
+		bench, err := profileFile(ctx, client, profiler, f, filterPrefix)
+		if err != nil && ctx.Err() != nil {
+			log.Warningf("benchmark over the file %s was interrupted", f)
+			break
+		}
+		if err := performance.CheckFailure(f, err, failFast); err != nil {
+			return err
 		}
-		benchmarks = append(benchmarks, performance.BenchmarkResultToBenchmark(f, bRes, filterPrefix))
+		benchmarks = append(benchmarks, bench)
+	}
+	emitProgress(len(benchmarks), len(files), "")
+	if failed := performance.CountFailed(benchmarks); failed > 0 {
+		log.Warningf("%d of %d files have failed", failed, len(benchmarks))
 	}
 
-	data, err := json.Marshal(benchmarks)
+	report := performance.Report{
+		Partial:     ctx.Err() != nil,
+		Environment: performance.Environment(),
+		Benchmarks:  benchmarks,
+	}
+	if report.Partial {
+		log.Warningf("interrupted after %d of %d files", len(benchmarks), len(files))
+	}
+
+	data, err := json.Marshal(report)
 	if err != nil {
 		return fmt.Errorf("failed to marshal results: %v", err)
 	}
@@ -97,17 +129,68 @@ func run(ctx context.Context, fixtures, resultsFile, filterPrefix string) (gerr
 	return nil
 }
 
-func benchFile(ctx context.Context, driver driver.Native, path string) (*testing.BenchmarkResult, error) {
-	data, err := ioutil.ReadFile(path)
+// emitProgress writes progress event to stdout, so it can be relayed by the host
+func emitProgress(done, total int, current string) {
+	e := performance.ProgressEvent{Done: done, Total: total, Current: current}
+	if err := performance.WriteProgressEvent(os.Stdout, e); err != nil {
+		log.Warningf("cannot emit progress: %v", err)
+	}
+}
+
+// profileFile performs benchmark over the file of a given path and writes its profiles if profiler is set
+func profileFile(ctx context.Context, driver driver.Native, profiler *performance.Profiler, path string, trimPrefix string) (performance.Benchmark, error) {
+	if profiler == nil {
+		return benchFile(ctx, driver, path, trimPrefix)
+	}
+
+	name := performance.ParseBenchmarkName(path, trimPrefix)
+	if err := profiler.Start(name); err != nil {
+		log.Warningf("cannot start profiling of the file %s: %v", path, err)
+	}
+	bench, err := benchFile(ctx, driver, path, trimPrefix)
+	if perr := profiler.Stop(name); perr != nil {
+		log.Warningf("cannot write profiles of the file %s: %v", path, perr)
+	}
+	return bench, err
+}
+
+// benchFile performs benchmark over the file of a given path, if benchmark fails then the error is returned
+// along with the failed benchmark, so it can be stored
+func benchFile(ctx context.Context, driver driver.Native, path string, trimPrefix string) (performance.Benchmark, error) {
+	fixture, err := performance.ReadFixture(path)
 	if err != nil {
-		return nil, err
+		return performance.FailedBenchmark(path, err, trimPrefix), err
 	}
 
-	res := testing.Benchmark(performance.Bench(func() {
-		_, err := driver.Parse(ctx, string(data))
-		if err != nil {
-			panic(err)
-		}
-	}))
-	return &res, nil
+	meter := performance.NewRuntimeMeter()
+	res, err := performance.BenchRounds(fixture.Bytes, meter.Reset, func() error {
+		meter.Sample()
+		_, err := driver.Parse(ctx, fixture.Content)
+		return err
+	})
+	runtimeStats := meter.Stop()
+	if err != nil {
+		return performance.FailedBenchmark(path, err, trimPrefix), err
+	}
+
+	bench := performance.FixtureBenchmark(fixture, res, trimPrefix)
+	storage.SetRuntimeMetrics(&bench, runtimeStats)
+	setASTMetrics(ctx, driver, fixture, &bench)
+	return bench, nil
+}
+
+// setASTMetrics parses a given fixture once more and stores the size of native AST to benchmark metrics
+func setASTMetrics(ctx context.Context, driver driver.Native, fixture *performance.Fixture, bench *performance.Benchmark) {
+	n, err := driver.Parse(ctx, fixture.Content)
+	if err != nil {
+		log.Warningf("cannot get AST of the file %s: %v", fixture.Path, err)
+		return
+	}
+
+	stats, err := performance.NewUASTStats(n)
+	if err != nil {
+		log.Warningf("cannot measure AST of the file %s: %v", fixture.Path, err)
+		return
+	}
+	storage.SetUASTMetrics(bench, stats)
 }
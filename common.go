@@ -25,6 +25,10 @@ const (
 	DriverNativeLevel = "driver-native"
 	// TransformsLevel is a metrics tag that represents benchmarks being run over transformations layer
 	TransformsLevel = "transforms"
+	// BblfshdColdStartLevel is a metrics tag that represents time from bblfshd container start till the first parse
+	BblfshdColdStartLevel = "bblfshd-cold-start"
+	// DriverColdStartLevel is a metrics tag that represents time from language driver container start till the first parse
+	DriverColdStartLevel = "driver-cold-start"
 
 	// FileFilterPrefix is a fileFilterPrefix of file that would be filtered from the list of files in a directory.
 	// Currently we use benchmark fixtures, file name pattern in this case is bench_*.${extension}
@@ -35,6 +39,8 @@ var (
 	// ErrCannotInstallCustomDriver is used when driver installation process has failed or test conditions
 	// do not allow to install it
 	ErrCannotInstallCustomDriver = errors.NewKind("custom driver cannot be installed: %v")
+	// ErrBenchmarkFailed is used when benchmark over the file has failed and the run is stopped because of it
+	ErrBenchmarkFailed = errors.NewKind("cannot perform benchmark over the file %v: %v")
 
 	errCmdFailed = errors.NewKind("command failed: %v, output: %v")
 )
@@ -42,29 +48,137 @@ var (
 // Benchmark is a wrapper around parse.Benchmark and serves for formatting and arranging data before storing
 type Benchmark struct {
 	Benchmark parse.Benchmark
+	// Bytes is a size of the benchmarked fixture in bytes, zero if unknown
+	Bytes int64
+	// Lines is an amount of lines in the benchmarked fixture, zero if unknown
+	Lines int64
+	// Error contains the message of error that caused benchmark to fail, empty if benchmark succeeded
+	Error string
+	// Metrics contains additional metrics collected during the benchmark, keyed by metric name
+	Metrics map[string]float64
+	// Tags contains tags specific to this benchmark, they override the common tags during the storing
+	Tags map[string]string
 }
 
 // NewBenchmark is a constructor for Benchmark
 func NewBenchmark(pb *parse.Benchmark, trimPrefixes ...string) Benchmark {
-	pb.Name = parseBenchmarkName(pb.Name, trimPrefixes...)
-	return Benchmark{*pb}
+	pb.Name = ParseBenchmarkName(pb.Name, trimPrefixes...)
+	return Benchmark{Benchmark: *pb}
 }
 
 // BenchmarkResultToBenchmark converts b *testing.BenchmarkResult *parse.Benchmark for further storing
 func BenchmarkResultToBenchmark(name string, b *testing.BenchmarkResult, trimPrefixes ...string) Benchmark {
-	return NewBenchmark(&parse.Benchmark{
+	pb := &parse.Benchmark{
 		Name:              name,
 		N:                 b.N,
 		NsPerOp:           float64(b.NsPerOp()),
 		AllocedBytesPerOp: uint64(b.AllocedBytesPerOp()),
 		AllocsPerOp:       uint64(b.AllocsPerOp()),
-	}, trimPrefixes...)
+		Measured:          parse.NsPerOp | parse.AllocedBytesPerOp | parse.AllocsPerOp,
+	}
+	if b.Bytes > 0 && b.T > 0 {
+		pb.MBPerS = (float64(b.Bytes) * float64(b.N) / 1e6) / b.T.Seconds()
+		pb.Measured |= parse.MBPerS
+	}
+
+	bench := NewBenchmark(pb, trimPrefixes...)
+	bench.Bytes = b.Bytes
+	return bench
+}
+
+// FixtureBenchmark converts the result of benchmark over a given fixture to Benchmark and attaches fixture's size
+// and content hash
+func FixtureBenchmark(f *Fixture, b *testing.BenchmarkResult, trimPrefixes ...string) Benchmark {
+	bench := BenchmarkResultToBenchmark(f.Path, b, trimPrefixes...)
+	bench.Bytes = f.Bytes
+	bench.Lines = f.Lines
+	bench.SetTag(FixtureHashTag, f.Hash)
+	return bench
+}
+
+// FailedBenchmark creates Benchmark that marks a given fixture as failed with a given error
+func FailedBenchmark(name string, err error, trimPrefixes ...string) Benchmark {
+	bench := NewBenchmark(&parse.Benchmark{Name: name}, trimPrefixes...)
+	bench.Error = err.Error()
+	return bench
+}
+
+// SetMetric sets the value of additional metric of benchmark
+func (b *Benchmark) SetMetric(name string, value float64) {
+	if b.Metrics == nil {
+		b.Metrics = make(map[string]float64)
+	}
+	b.Metrics[name] = value
+}
+
+// SetTag sets the value of benchmark specific tag
+func (b *Benchmark) SetTag(name, value string) {
+	if b.Tags == nil {
+		b.Tags = make(map[string]string)
+	}
+	b.Tags[name] = value
+}
+
+// Failed reports whether the benchmark has failed
+func (b Benchmark) Failed() bool { return b.Error != "" }
+
+// CheckFailure handles the error of benchmark over a given file: if failFast is set the error is returned,
+// so the run stops, otherwise it's logged, so the failed benchmark is stored and the run proceeds.
+// Nil error is ignored
+func CheckFailure(file string, err error, failFast bool) error {
+	if err == nil {
+		return nil
+	}
+	if failFast {
+		return ErrBenchmarkFailed.New(file, err)
+	}
+	log.Errorf(err, "benchmark over the file %s has failed", file)
+	return nil
 }
 
-// parseBenchmarkName removes the path and suffixes from benchmark info
+// CountFailed returns the amount of failed benchmarks
+func CountFailed(benchmarks []Benchmark) int {
+	var n int
+	for _, b := range benchmarks {
+		if b.Failed() {
+			n++
+		}
+	}
+	return n
+}
+
+// MBPerSecond returns the throughput of benchmark in megabytes per second.
+// If it was not measured by benchmark itself it's computed using the fixture size, zero is returned if size is unknown
+func (b Benchmark) MBPerSecond() float64 {
+	if b.Benchmark.Measured&parse.MBPerS != 0 {
+		return b.Benchmark.MBPerS
+	}
+	if b.Bytes <= 0 || b.Benchmark.NsPerOp <= 0 {
+		return 0
+	}
+	return (float64(b.Bytes) / 1e6) / (b.Benchmark.NsPerOp / 1e9)
+}
+
+// NsPerByte returns nanoseconds spent per byte of the fixture, zero is returned if size is unknown
+func (b Benchmark) NsPerByte() float64 {
+	if b.Bytes <= 0 {
+		return 0
+	}
+	return b.Benchmark.NsPerOp / float64(b.Bytes)
+}
+
+// NsPerLine returns nanoseconds spent per line of the fixture, zero is returned if size is unknown
+func (b Benchmark) NsPerLine() float64 {
+	if b.Lines <= 0 {
+		return 0
+	}
+	return b.Benchmark.NsPerOp / float64(b.Lines)
+}
+
+// ParseBenchmarkName removes the path and suffixes from benchmark info
 // Example1: BenchmarkGoDriver/transform/accumulator_factory-4 -> accumulator_factory
 // Example2: BenchmarkGoDriver/transform/bench_accumulator_factory-4 -> accumulator_factory, where "bench_" is a trimPrefixes
-func parseBenchmarkName(name string, trimPrefixes ...string) string {
+func ParseBenchmarkName(name string, trimPrefixes ...string) string {
 	trim := func(name string) (res string) {
 		for _, tp := range trimPrefixes {
 			if strings.HasPrefix(name, tp) {
@@ -168,11 +282,39 @@ func ExecCmd(command string) error {
 	return nil
 }
 
-// Bench wraps given function into function that performs benchmark over it
-func Bench(f func()) func(b *testing.B) {
-	return func(b *testing.B) {
+// BenchTimer controls the timer of the running benchmark, it's implemented by *testing.B
+type BenchTimer interface {
+	// StopTimer stops timing, the time until StartTimer is not measured
+	StopTimer()
+	// StartTimer resumes timing
+	StartTimer()
+}
+
+// Bench performs benchmark over a given function, bytes is the amount of bytes processed per operation
+// and is used to compute MB/s. Benchmark stops on the first error returned by f and this error is returned
+func Bench(bytes int64, f func() error) (*testing.BenchmarkResult, error) {
+	return BenchRounds(bytes, nil, f)
+}
+
+// BenchRounds is Bench that calls round before each round of the benchmark with its timer, the harness runs
+// several rounds with growing amount of operations and only the last one is returned, so per-round state
+// should be reset by round. Nil round is ignored
+func BenchRounds(bytes int64, round func(t BenchTimer), f func() error) (*testing.BenchmarkResult, error) {
+	var gerr error
+	res := testing.Benchmark(func(b *testing.B) {
+		if round != nil {
+			round(b)
+		}
+		b.SetBytes(bytes)
 		for i := 0; i < b.N; i++ {
-			f()
+			if err := f(); err != nil {
+				gerr = err
+				b.FailNow()
+			}
 		}
+	})
+	if gerr != nil {
+		return nil, gerr
 	}
+	return &res, nil
 }
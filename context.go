@@ -0,0 +1,75 @@
+package performance
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gopkg.in/src-d/go-log.v1"
+)
+
+const (
+	// PartialTag is a storage label that marks results of interrupted run, only the completed benchmarks are stored
+	PartialTag = "partial"
+	// MaxDurationFlag is a name of the global flag that limits the duration of the command
+	MaxDurationFlag = "max-duration"
+)
+
+// Report represents the results of benchmarks along with the flag that shows if the run was interrupted
+// and the environment they were run in
+type Report struct {
+	// Partial is true if the run was interrupted and not all the benchmarks were completed
+	Partial bool
+	// Environment contains tags that describe the environment of the run
+	Environment map[string]string
+	// Benchmarks contains the results of completed benchmarks
+	Benchmarks []Benchmark
+}
+
+// NewContext returns the context that is cancelled on SIGINT or SIGTERM, or when max duration passes if it's positive.
+// Cancellation interrupts in-flight requests, so the benchmark in progress is discarded.
+// After the first signal default handling is restored, so the second signal terminates the process immediately
+func NewContext(maxDuration time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if maxDuration > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, maxDuration)
+		cancelParent := cancel
+		cancel = func() {
+			cancelTimeout()
+			cancelParent()
+		}
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case s := <-c:
+			log.Warningf("received %v, stopping: the current benchmark is cancelled and not stored", s)
+			signal.Stop(c)
+			cancel()
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				log.Warningf("max duration %v has passed, stopping: the current benchmark is cancelled and not stored", maxDuration)
+			}
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(c)
+		cancel()
+	}
+}
+
+// PartialTags adds the partial tag to given tags if the run was interrupted. Interruption should be recorded
+// when benchmarks stop, so the run that has completed before the context is cancelled is not marked as partial
+func PartialTags(partial bool, tags map[string]string) map[string]string {
+	if partial {
+		log.Warningf("run was interrupted, storing partial results")
+		tags[PartialTag] = "true"
+	}
+	return tags
+}
@@ -1,11 +1,14 @@
 package docker
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/bblfsh/performance"
@@ -22,11 +25,16 @@ const (
 	bblfshdImage     = "bblfsh/bblfshd"
 	bblfshdContainer = "bblfshd-perf"
 	bblfshdPort      = "9432"
+	// BblfshdMetricsPort is a port of Prometheus endpoint of bblfshd
+	BblfshdMetricsPort = "2112"
 
 	// driver default configuration
 	driverContainer = "driver"
 
 	execTimeoutSeconds = 300
+	// portWaitInterval is a delay between attempts to connect to the port of started container, it's fixed
+	// and small, so the time till the port is ready is not inflated by the backoff
+	portWaitInterval = 10 * time.Millisecond
 )
 
 var (
@@ -37,6 +45,8 @@ var (
 	errExecFailed            = errors.NewKind("failed to exec command")
 	errUploadFailed          = errors.NewKind("upload failed")
 	errGetResultsFailed      = errors.NewKind("get results failed")
+	errDownloadFailed        = errors.NewKind("download failed")
+	errPullFailed            = errors.NewKind("cannot pull image %v")
 )
 
 // Driver is a struct that eases interaction with driver container
@@ -47,6 +57,10 @@ type Driver struct {
 	Pool *dockertest.Pool
 	// Resource contains container metadata
 	Resource *dockertest.Resource
+	// Limits contains resource limits the container was started with
+	Limits Limits
+	// Started is the time the container was started at according to the docker daemon
+	Started time.Time
 }
 
 // TODO(lwsanty): use UploadToContainer for more various data
@@ -87,20 +101,83 @@ func (d *Driver) Upload(ctx context.Context, src, dst string) error {
 	return nil
 }
 
+// Download copies the file or directory of a given path from container to the host directory dst
+func (d *Driver) Download(ctx context.Context, src, dst string) error {
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(d.Pool.Client.DownloadFromContainer(d.Resource.Container.ID, docker.DownloadFromContainerOptions{
+			Context:      ctx,
+			OutputStream: w,
+			Path:         src,
+		}))
+	}()
+
+	if err := untar(r, dst); err != nil {
+		r.CloseWithError(err)
+		return errDownloadFailed.Wrap(err)
+	}
+	return nil
+}
+
+// untar extracts regular files and directories of a given tar stream to the directory dst
+func untar(r io.Reader, dst string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dst, filepath.Clean("/"+hdr.Name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			f, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
 // GetResults reads result files inside the container
 // Do not use it on large files!
 func (d *Driver) GetResults(ctx context.Context, src string) ([]byte, error) {
+	data, err := d.output(ctx, "cat "+src)
+	if err != nil {
+		return nil, errGetResultsFailed.Wrap(err)
+	}
+	return data, nil
+}
+
+// output executes a given shell command inside the container and returns its stdout
+func (d *Driver) output(ctx context.Context, sh string) ([]byte, error) {
 	exec, err := d.Pool.Client.CreateExec(docker.CreateExecOptions{
 		AttachStdin:  true,
 		AttachStdout: true,
 		AttachStderr: true,
 		Context:      ctx,
-		Cmd:          []string{"sh", "-c", "cat " + src},
+		Cmd:          []string{"sh", "-c", sh},
 		Container:    d.Resource.Container.ID,
 		Privileged:   true,
 	})
 	if err != nil {
-		return nil, errGetResultsFailed.Wrap(err)
+		return nil, err
 	}
 
 	var buf bytes.Buffer
@@ -110,7 +187,7 @@ func (d *Driver) GetResults(ctx context.Context, src string) ([]byte, error) {
 		ErrorStream:  os.Stderr,
 	})
 	if err != nil {
-		return nil, errGetResultsFailed.Wrap(err)
+		return nil, err
 	}
 
 	return buf.Bytes(), nil
@@ -118,6 +195,11 @@ func (d *Driver) GetResults(ctx context.Context, src string) ([]byte, error) {
 
 // Exec executes given command inside the driver, sends output to Stdout and returns error if commands exit code != 0
 func (d *Driver) Exec(ctx context.Context, envs []string, cmd ...string) error {
+	return d.ExecStream(ctx, os.Stderr, envs, cmd...)
+}
+
+// ExecStream is the same as Exec, but sends output to a given writer
+func (d *Driver) ExecStream(ctx context.Context, out io.Writer, envs []string, cmd ...string) error {
 	log.Debugf("creating exec")
 	exec, err := d.Pool.Client.CreateExec(docker.CreateExecOptions{
 		AttachStdin:  true,
@@ -139,8 +221,8 @@ func (d *Driver) Exec(ctx context.Context, envs []string, cmd ...string) error {
 		Context:      ctx,
 		RawTerminal:  true,
 		Tty:          true,
-		OutputStream: os.Stderr,
-		ErrorStream:  os.Stderr,
+		OutputStream: out,
+		ErrorStream:  out,
 	})
 	if err != nil {
 		return errExecFailed.Wrap(err)
@@ -167,15 +249,37 @@ func (d *Driver) Exec(ctx context.Context, envs []string, cmd ...string) error {
 	return errors.NewKind("timeout").New()
 }
 
+// Interrupt sends SIGTERM to the processes inside the container that were started from a given executable,
+// processes are matched by the exact name of the executable, so the ones that only have it in arguments are not signalled
+func (d *Driver) Interrupt(ctx context.Context, executable string) error {
+	sh := fmt.Sprintf("pids=$(pidof %s) && kill -TERM $pids", filepath.Base(executable))
+	return d.Exec(ctx, nil, "sh", "-c", sh)
+}
+
+// HostAddress returns the host address of a given container port
+func (d *Driver) HostAddress(port string) string {
+	return d.Resource.GetHostPort(port + "/tcp")
+}
+
 // Close removes container
 func (d *Driver) Close() { purge(d.Pool, d.Resource) }
 
 // RunBblfshd pulls and runs bblfshd container with a given tag, waits until the port is ready and returns
 // endpoint address and a closer that performs post-cleanup
 func RunBblfshd(tag string) (string, func(), error) {
+	bblfshd, err := StartBblfshd(tag)
+	if err != nil {
+		return "", nil, err
+	}
+	return bblfshd.Address, bblfshd.Close, nil
+}
+
+// StartBblfshd is the same as RunBblfshd, but returns the container for further interaction
+func StartBblfshd(tag string) (*Driver, error) {
+	defer performance.Trace(performance.TraceCategoryDocker, "start bblfshd", map[string]string{"tag": tag})()
 	pool, err := dockertest.NewPool("")
 	if err != nil {
-		return "", nil, wrapErr(err, errConnectToDockerFailed)
+		return nil, wrapErr(err, errConnectToDockerFailed)
 	}
 
 	resource, err := pool.RunWithOptions(
@@ -184,28 +288,35 @@ func RunBblfshd(tag string) (string, func(), error) {
 			Repository:   bblfshdImage,
 			Tag:          tag,
 			Privileged:   true,
-			ExposedPorts: []string{bblfshdPort},
+			ExposedPorts: []string{bblfshdPort, BblfshdMetricsPort},
 			Mounts:       []string{"/var/run/docker.sock:/var/run/docker.sock"},
 			PortBindings: map[docker.Port][]docker.PortBinding{
 				bblfshdPort: {{HostPort: bblfshdPort}},
 			},
-		})
+		}, limits.apply)
 	if err != nil {
-		return "", nil, wrapErr(err, errResourceStartFailed)
+		return nil, wrapErr(err, errResourceStartFailed)
 	}
 
 	addr := resource.GetHostPort(bblfshdPort + "/tcp")
 	log.Debugf("addr used: %s", addr)
 	if err := wait(pool, addr); err != nil {
 		purge(pool, resource)
-		return "", nil, err
+		return nil, err
 	}
 
-	return addr, func() { purge(pool, resource) }, nil
+	return newDriver(addr, pool, resource), nil
 }
 
 // RunDriver runs driver of given image and mounts
 func RunDriver(image *Image, mounts ...string) (*Driver, error) {
+	return RunDriverWithPorts(image, nil, mounts...)
+}
+
+// RunDriverWithPorts is the same as RunDriver, but also exposes given container ports on random host ports,
+// their addresses can be obtained using HostAddress
+func RunDriverWithPorts(image *Image, ports []string, mounts ...string) (*Driver, error) {
+	defer performance.Trace(performance.TraceCategoryDocker, "start driver", map[string]string{"image": image.toString(true)})()
 	pool, err := dockertest.NewPool("")
 	if err != nil {
 		return nil, wrapErr(err, errConnectToDockerFailed)
@@ -217,12 +328,12 @@ func RunDriver(image *Image, mounts ...string) (*Driver, error) {
 			Repository:   image.toString(false),
 			Tag:          image.Tag,
 			Privileged:   true,
-			ExposedPorts: []string{bblfshdPort},
+			ExposedPorts: append([]string{bblfshdPort}, ports...),
 			Mounts:       append(mounts, "/var/run/docker.sock:/var/run/docker.sock"),
 			PortBindings: map[docker.Port][]docker.PortBinding{
 				bblfshdPort: {{HostPort: bblfshdPort}},
 			},
-		})
+		}, limits.apply)
 	if err != nil {
 		return nil, wrapErr(err, errResourceStartFailed)
 	}
@@ -235,25 +346,56 @@ func RunDriver(image *Image, mounts ...string) (*Driver, error) {
 		return nil, err
 	}
 
+	return newDriver(addr, pool, resource), nil
+}
+
+func newDriver(addr string, pool *dockertest.Pool, resource *dockertest.Resource) *Driver {
 	return &Driver{
 		Address:  addr,
 		Pool:     pool,
 		Resource: resource,
-	}, nil
+		Limits:   limits,
+		Started:  resource.Container.State.StartedAt,
+	}
 }
 
+// wait polls a given address with a fixed interval until it accepts connections or pool's MaxWait passes
 func wait(pool *dockertest.Pool, addr string) error {
-	return pool.Retry(func() error {
+	deadline := time.Now().Add(pool.MaxWait)
+	for {
 		conn, err := net.DialTimeout("tcp", addr, time.Second/4)
 		if err == nil {
 			conn.Close()
 			return nil
 		}
-		return wrapErr(errPortWaitTimeout.New(bblfshdPort))
-	})
+		if time.Now().After(deadline) {
+			return wrapErr(errPortWaitTimeout.New(bblfshdPort))
+		}
+		time.Sleep(portWaitInterval)
+	}
+}
+
+// pullBblfshd pulls bblfshd image of a given tag unless it's already present
+func pullBblfshd(tag string) error {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		return wrapErr(err, errConnectToDockerFailed)
+	}
+	image := bblfshdImage + ":" + tag
+	if _, err := pool.Client.InspectImage(image); err == nil {
+		return nil
+	}
+
+	defer performance.Trace(performance.TraceCategoryDocker, "pull bblfshd", map[string]string{"tag": tag})()
+	err = pool.Client.PullImage(docker.PullImageOptions{Repository: bblfshdImage, Tag: tag}, docker.AuthConfiguration{})
+	if err != nil {
+		return errPullFailed.Wrap(err, image)
+	}
+	return nil
 }
 
 func purge(p *dockertest.Pool, resources ...*dockertest.Resource) {
+	defer performance.Trace(performance.TraceCategoryDocker, "remove container", nil)()
 	for _, r := range resources {
 		if err := p.Purge(r); err != nil {
 			log.Errorf(err, "could not purge resource: %s", r.Container.Name)
@@ -30,6 +30,7 @@ type Image struct {
 // builds docker image and installs driver's image to bblfshd container.
 // Requires bblfshd container running.
 func InstallDriver(language, commit string) error {
+	defer performance.Trace(performance.TraceCategoryDocker, "install driver", map[string]string{"language": language, "commit": commit})()
 	image, err := DownloadAndBuildDriver(language, commit)
 	if err != nil {
 		return err
@@ -44,6 +45,7 @@ func InstallDriver(language, commit string) error {
 // language - name of the supported language(check docker/conf/drivers.json)
 // commit - commit hash to checkout to
 func DownloadAndBuildDriver(language, commit string) (*Image, error) {
+	defer performance.Trace(performance.TraceCategoryDocker, "build driver image", map[string]string{"language": language, "commit": commit})()
 	driver, err := getDriver(language)
 	if err != nil {
 		return nil, err
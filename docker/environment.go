@@ -0,0 +1,77 @@
+package docker
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/bblfsh/performance"
+
+	"github.com/ory/dockertest"
+	"github.com/ory/dockertest/docker"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// Environment returns tags that describe Docker server version, the digest of the container image and
+// its resource limits, values that cannot be obtained are omitted
+func (d *Driver) Environment() map[string]string {
+	env := d.Limits.Tags()
+
+	version, err := d.Pool.Client.Version()
+	if err != nil {
+		log.Warningf("cannot get docker version: %v", err)
+	} else if v := version.Get("Version"); v != "" {
+		env[performance.DockerVersionTag] = v
+	}
+
+	image, err := d.Pool.Client.InspectImage(d.Resource.Container.Image)
+	if err != nil {
+		log.Warningf("cannot inspect image of the container %s: %v", d.Resource.Container.Name, err)
+		return env
+	}
+	// repo digest identifies pulled images, locally built ones have only ID
+	if len(image.RepoDigests) > 0 {
+		env[performance.ImageDigestTag] = image.RepoDigests[0]
+	} else {
+		env[performance.ImageDigestTag] = image.ID
+	}
+	return env
+}
+
+// RunningContainers returns an amount of running containers except the one that publishes the port
+// of a given host:port address, it's used to skip the benchmarked container started externally.
+// Empty address excludes nothing
+func RunningContainers(exclude string) (int, error) {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		return 0, wrapErr(err, errConnectToDockerFailed)
+	}
+	containers, err := pool.Client.ListContainers(docker.ListContainersOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	var port int64 = -1
+	if _, p, err := net.SplitHostPort(exclude); err == nil {
+		if n, err := strconv.ParseInt(p, 10, 64); err == nil {
+			port = n
+		}
+	}
+
+	n := len(containers)
+	for _, c := range containers {
+		if publishes(c, port) {
+			n--
+		}
+	}
+	return n, nil
+}
+
+// publishes reports whether a given container publishes a given port on the host
+func publishes(c docker.APIContainers, port int64) bool {
+	for _, p := range c.Ports {
+		if p.PublicPort == port {
+			return true
+		}
+	}
+	return false
+}
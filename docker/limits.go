@@ -0,0 +1,65 @@
+package docker
+
+import (
+	"strconv"
+
+	"github.com/bblfsh/performance"
+
+	"github.com/ory/dockertest/docker"
+)
+
+// cpuPeriod is a CFS period in microseconds that is used to apply CPU quota
+const cpuPeriod = 100000
+
+// Limits constrains resources of the benchmarked containers to reduce the noise from other jobs on the host
+type Limits struct {
+	// CPUSet is a list of CPUs the container is pinned to, e.g. "2-3" or "2,4", empty means no pinning
+	CPUSet string
+	// CPUs is a CPU quota of the container in cores, 0 means no quota
+	CPUs float64
+	// Memory is a memory limit of the container in bytes, 0 means no limit
+	Memory int64
+}
+
+// limits are applied to all containers started by the package
+var limits Limits
+
+// SetLimits sets resource limits of all the containers started afterwards
+func SetLimits(l Limits) error {
+	if l.CPUSet != "" {
+		if _, err := performance.ParseCPUList(l.CPUSet); err != nil {
+			return err
+		}
+	}
+	limits = l
+	return nil
+}
+
+// apply sets the limits to a given host config of the container
+func (l Limits) apply(hc *docker.HostConfig) {
+	hc.CPUSetCPUs = l.CPUSet
+	if l.CPUs > 0 {
+		hc.CPUPeriod = cpuPeriod
+		hc.CPUQuota = int64(l.CPUs * cpuPeriod)
+	}
+	if l.Memory > 0 {
+		hc.Memory = l.Memory
+		// swap is disabled, so the container cannot exceed the limit silently
+		hc.MemorySwap = l.Memory
+	}
+}
+
+// Tags returns storage tags that describe the applied limits, limits that are not set are omitted
+func (l Limits) Tags() map[string]string {
+	tags := make(map[string]string)
+	if l.CPUSet != "" {
+		tags[performance.CPUSetTag] = l.CPUSet
+	}
+	if l.CPUs > 0 {
+		tags[performance.CPUQuotaTag] = strconv.FormatFloat(l.CPUs, 'f', -1, 64)
+	}
+	if l.Memory > 0 {
+		tags[performance.MemoryLimitTag] = strconv.FormatInt(l.Memory, 10)
+	}
+	return tags
+}
@@ -0,0 +1,182 @@
+package docker
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bblfsh/performance"
+
+	"github.com/ory/dockertest/docker"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// Sampler streams resource usage of the container and aggregates it over periods, it implements
+// performance.ResourceSampler. Docker sends stats about once per second, so periods shorter than that may have no samples
+type Sampler struct {
+	mu sync.Mutex
+	// base is the last sample before the current period, deltas of counters are computed against it
+	base *docker.Stats
+	// last is the last sample of the current period
+	last    *docker.Stats
+	samples int
+	peakRSS uint64
+
+	driver *Driver
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartSampler starts streaming resource usage of the container, Stop should be called to release resources
+func (d *Driver) StartSampler(ctx context.Context) *Sampler {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Sampler{driver: d, ctx: ctx, cancel: cancel, done: make(chan struct{})}
+
+	ch := make(chan *docker.Stats)
+	go func() {
+		err := d.Pool.Client.Stats(docker.StatsOptions{
+			ID:                d.Resource.Container.ID,
+			Stats:             ch,
+			Stream:            true,
+			Timeout:           statsTimeout,
+			InactivityTimeout: statsTimeout,
+			Context:           ctx,
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Warningf("container resources sampling has stopped: %v", err)
+		}
+	}()
+	go func() {
+		defer close(s.done)
+		for st := range ch {
+			s.add(st)
+		}
+	}()
+	return s
+}
+
+func (s *Sampler) add(st *docker.Stats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.base == nil {
+		s.base = st
+		return
+	}
+	s.last = st
+	s.samples++
+	if rss := memoryUsage(st); rss > s.peakRSS {
+		s.peakRSS = rss
+	}
+}
+
+// Reset implements performance.ResourceSampler, it takes a fresh sample, so the period starts at the time of Reset
+// instead of the last streamed sample, if the sample cannot be taken the last streamed one is used
+func (s *Sampler) Reset() {
+	st, err := s.driver.Stats(s.ctx)
+	if err != nil && s.ctx.Err() == nil {
+		log.Warningf("cannot sample container resources: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restart(st)
+}
+
+// Mark starts a new period without blocking, the last streamed sample is used as its start, so the period
+// may start up to the streaming interval earlier. It's used when the caller cannot wait for a fresh sample
+func (s *Sampler) Mark() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restart(nil)
+}
+
+// restart starts a new period from a given sample or from the last streamed one if it's nil
+func (s *Sampler) restart(st *docker.Stats) {
+	if st == nil {
+		st = s.last
+	}
+	if st != nil {
+		s.base = st
+	}
+	s.last = nil
+	s.samples = 0
+	s.peakRSS = 0
+	if s.base != nil {
+		s.peakRSS = memoryUsage(s.base)
+	}
+}
+
+// Collect implements performance.ResourceSampler
+func (s *Sampler) Collect() performance.ResourceStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.base == nil || s.last == nil {
+		return performance.ResourceStats{}
+	}
+
+	base, last := s.base, s.last
+	res := performance.ResourceStats{
+		Samples:         s.samples,
+		PeakRSS:         s.peakRSS,
+		PageFaults:      delta(pageFaults(base), pageFaults(last)),
+		MajorPageFaults: delta(majorPageFaults(base), majorPageFaults(last)),
+	}
+
+	cpu := delta(base.CPUStats.CPUUsage.TotalUsage, last.CPUStats.CPUUsage.TotalUsage)
+	system := delta(base.CPUStats.SystemCPUUsage, last.CPUStats.SystemCPUUsage)
+	if system > 0 {
+		res.CPUPercent = float64(cpu) / float64(system) * float64(onlineCPUs(last)) * 100
+	}
+
+	baseRx, baseTx := network(base)
+	lastRx, lastTx := network(last)
+	res.NetworkRxBytes = delta(baseRx, lastRx)
+	res.NetworkTxBytes = delta(baseTx, lastTx)
+	return res
+}
+
+// Stop stops streaming of resource usage
+func (s *Sampler) Stop() {
+	s.cancel()
+	<-s.done
+}
+
+// delta returns the increase of a counter, counters reset by container restart give zero
+func delta(from, to uint64) uint64 {
+	if to < from {
+		return 0
+	}
+	return to - from
+}
+
+func pageFaults(s *docker.Stats) uint64 {
+	if f := s.MemoryStats.Stats.TotalPgfault; f > 0 {
+		return f
+	}
+	return s.MemoryStats.Stats.Pgfault
+}
+
+func majorPageFaults(s *docker.Stats) uint64 {
+	if f := s.MemoryStats.Stats.TotalPgmafault; f > 0 {
+		return f
+	}
+	return s.MemoryStats.Stats.Pgmajfault
+}
+
+func onlineCPUs(s *docker.Stats) uint64 {
+	if n := s.CPUStats.OnlineCPUs; n > 0 {
+		return n
+	}
+	return uint64(len(s.CPUStats.CPUUsage.PercpuUsage))
+}
+
+// network returns the amounts of bytes received and sent through all the container networks
+func network(s *docker.Stats) (rx, tx uint64) {
+	for _, n := range s.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+	return rx, tx
+}
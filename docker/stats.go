@@ -0,0 +1,79 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/ory/dockertest/docker"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+const statsTimeout = 10 * time.Second
+
+var (
+	errStatsFailed    = errors.NewKind("cannot get container stats")
+	errCPUUsageFailed = errors.NewKind("cannot get container CPU usage")
+)
+
+// Stats returns a single snapshot of container resource usage
+func (d *Driver) Stats(ctx context.Context) (*docker.Stats, error) {
+	ch := make(chan *docker.Stats, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- d.Pool.Client.Stats(docker.StatsOptions{
+			ID:                d.Resource.Container.ID,
+			Stats:             ch,
+			Stream:            false,
+			Timeout:           statsTimeout,
+			InactivityTimeout: statsTimeout,
+			Context:           ctx,
+		})
+	}()
+
+	var last *docker.Stats
+	for s := range ch {
+		last = s
+	}
+	if err := <-errCh; err != nil {
+		return nil, errStatsFailed.Wrap(err)
+	}
+	if last == nil {
+		return nil, errStatsFailed.New()
+	}
+	return last, nil
+}
+
+// MemoryUsage returns resident memory of the container processes in bytes, page cache is not counted
+func (d *Driver) MemoryUsage(ctx context.Context) (uint64, error) {
+	s, err := d.Stats(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return memoryUsage(s), nil
+}
+
+// memoryUsage returns total_rss for cgroup v1, cgroup v2 has no rss, so inactive file cache is subtracted from usage
+// the same way as docker stats does, the cache is subtracted for older daemons that report neither of them
+func memoryUsage(s *docker.Stats) uint64 {
+	if rss := s.MemoryStats.Stats.TotalRss; rss > 0 {
+		return rss
+	}
+	if inactive := s.MemoryStats.Stats.InactiveFile; inactive > 0 && s.MemoryStats.Usage > inactive {
+		return s.MemoryStats.Usage - inactive
+	}
+	if s.MemoryStats.Usage > s.MemoryStats.Stats.Cache {
+		return s.MemoryStats.Usage - s.MemoryStats.Stats.Cache
+	}
+	return s.MemoryStats.Usage
+}
+
+// CPUUsage returns total CPU time consumed by the container processes according to cgroup CPU accounting,
+// it's taken from the stats of docker daemon, so nothing is executed inside the container.
+// It implements performance.CPUCounter
+func (d *Driver) CPUUsage(ctx context.Context) (time.Duration, error) {
+	s, err := d.Stats(ctx)
+	if err != nil {
+		return 0, errCPUUsageFailed.Wrap(err)
+	}
+	return time.Duration(s.CPUStats.CPUUsage.TotalUsage), nil
+}
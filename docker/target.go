@@ -0,0 +1,77 @@
+package docker
+
+import (
+	"github.com/bblfsh/performance"
+
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+const (
+	// TargetDriver is a kind of target that runs language driver container built from the commit of its repository
+	TargetDriver = "driver"
+	// TargetBblfshd is a kind of target that runs bblfshd container with pre-installed drivers
+	TargetBblfshd = "bblfshd"
+
+	// BblfshdDefaultTag is a tag of bblfshd image with all drivers pre-installed
+	BblfshdDefaultTag = "latest-drivers"
+)
+
+var errUnknownTarget = errors.NewKind("unknown target %v, supported: " + TargetDriver + ", " + TargetBblfshd)
+
+// Target prepares and starts containers of either language driver or bblfshd, so they can be benchmarked
+// through the same GRPC API
+type Target struct {
+	kind  string
+	tag   string
+	image *Image
+}
+
+// NewTarget validates a given kind of target and prepares its image: the driver of a given language is built
+// from a given commit and bblfshd image of a given tag is pulled
+func NewTarget(kind, language, commit, tag string) (*Target, error) {
+	t := &Target{kind: kind, tag: tag}
+	switch kind {
+	case TargetDriver:
+		log.Debugf("download and build driver")
+		image, err := DownloadAndBuildDriver(language, commit)
+		if err != nil {
+			return nil, err
+		}
+		t.image = image
+	case TargetBblfshd:
+		log.Debugf("pull bblfshd %s image", tag)
+		if err := pullBblfshd(tag); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errUnknownTarget.New(kind)
+	}
+	return t, nil
+}
+
+// Start runs a fresh container of the target and waits until its GRPC port is ready
+func (t *Target) Start() (*Driver, error) {
+	if t.kind == TargetDriver {
+		log.Debugf("run driver container")
+		return RunDriver(t.image)
+	}
+	log.Debugf("running bblfshd %s container", t.tag)
+	return StartBblfshd(t.tag)
+}
+
+// Level returns the level of bblfsh architecture the target belongs to
+func (t *Target) Level() string {
+	if t.kind == TargetDriver {
+		return performance.DriverLevel
+	}
+	return performance.BblfshdLevel
+}
+
+// ColdStartLevel returns the level of cold start benchmarks of the target
+func (t *Target) ColdStartLevel() string {
+	if t.kind == TargetDriver {
+		return performance.DriverColdStartLevel
+	}
+	return performance.BblfshdColdStartLevel
+}
@@ -0,0 +1,97 @@
+package performance
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CPUModelTag is a storage label that contains CPU model of the host
+	CPUModelTag = "cpu_model"
+	// CPUCoresTag is a storage label that contains an amount of logical CPU cores available to the process
+	CPUCoresTag = "cpu_cores"
+	// GOMAXPROCSTag is a storage label that contains GOMAXPROCS of the process
+	GOMAXPROCSTag = "gomaxprocs"
+	// KernelTag is a storage label that contains kernel version of the host
+	KernelTag = "kernel"
+	// GoVersionTag is a storage label that contains Go version the tool was built with
+	GoVersionTag = "go_version"
+	// ToolVersionTag is a storage label that contains version of the tool
+	ToolVersionTag = "tool_version"
+	// DockerVersionTag is a storage label that contains Docker server version
+	DockerVersionTag = "docker_version"
+	// ImageDigestTag is a storage label that contains digest of the image of the benchmarked container
+	ImageDigestTag = "image_digest"
+
+	// ContainerTagPrefix is a prefix of storage labels that describe the environment inside the container
+	ContainerTagPrefix = "container_"
+)
+
+// Version is a version of the tool, it's set by main packages from build flags
+var Version = "undefined"
+
+// Environment returns tags that describe the host and the tool: CPU model, amount of cores, GOMAXPROCS,
+// kernel version, Go version and tool version along with the result of CheckHost if it was called
+// and the sampling rate of requests if tracing is enabled.
+// Values that cannot be detected are omitted
+func Environment() map[string]string {
+	env := map[string]string{
+		CPUCoresTag:    strconv.Itoa(runtime.NumCPU()),
+		GOMAXPROCSTag:  strconv.Itoa(runtime.GOMAXPROCS(0)),
+		GoVersionTag:   runtime.Version(),
+		ToolVersionTag: Version,
+	}
+	if model := cpuModel(); model != "" {
+		env[CPUModelTag] = model
+	}
+	if data, err := ioutil.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		env[KernelTag] = strings.TrimSpace(string(data))
+	}
+	if clientCPUSet != "" {
+		env[ClientCPUSetTag] = clientCPUSet
+	}
+	return MergeTags(env, hostTags, traceTags())
+}
+
+// cpuModel returns CPU model name from /proc/cpuinfo
+func cpuModel() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		kv := strings.SplitN(s.Text(), ":", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "model name" {
+			return strings.TrimSpace(kv[1])
+		}
+	}
+	return ""
+}
+
+// MergeTags adds given tags to tags without overriding the existing ones and returns the result
+func MergeTags(tags map[string]string, more ...map[string]string) map[string]string {
+	for _, m := range more {
+		for k, v := range m {
+			if _, ok := tags[k]; !ok {
+				tags[k] = v
+			}
+		}
+	}
+	return tags
+}
+
+// PrefixTags returns a copy of given tags with names prefixed by a given prefix
+func PrefixTags(prefix string, tags map[string]string) map[string]string {
+	res := make(map[string]string, len(tags))
+	for k, v := range tags {
+		res[prefix+k] = v
+	}
+	return res
+}
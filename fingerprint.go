@@ -0,0 +1,138 @@
+package performance
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+const (
+	// FixtureHashTag is a benchmark specific metrics tag that contains the hash of fixture content
+	FixtureHashTag = "fixture_hash"
+	// CorpusHashTag is a metrics tag that contains the hash of all benchmarked fixtures
+	CorpusHashTag = "corpus_hash"
+
+	// hashLen is a length of hex encoded hashes, it's enough to tell the fixtures apart
+	hashLen = 16
+)
+
+var errFingerprintFailed = errors.NewKind("cannot process fingerprint file %v")
+
+// Fingerprint identifies the content of benchmarked fixtures, so results produced from different fixtures
+// are not compared by mistake
+type Fingerprint struct {
+	// Corpus is a hash over all fixtures
+	Corpus string
+	// Fixtures maps the names of fixtures to the hashes of their content
+	Fixtures map[string]string
+}
+
+// NewFingerprint reads given files and computes hashes of each of them and of the whole corpus.
+// Fixtures are named by their file names, the ones that have the same name in different directories are named
+// by their paths
+func NewFingerprint(files []string) (*Fingerprint, error) {
+	count := make(map[string]int, len(files))
+	for _, f := range files {
+		count[filepath.Base(f)]++
+	}
+
+	fp := &Fingerprint{Fixtures: make(map[string]string, len(files))}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(f)
+		if count[name] > 1 {
+			name = f
+		}
+		fp.Fixtures[name] = hash(data)
+	}
+
+	names, hashes := SplitStringMap(fp.Fixtures)
+	h := sha256.New()
+	for i := range names {
+		h.Write([]byte(names[i] + "\x00" + hashes[i] + "\n"))
+	}
+	fp.Corpus = hex.EncodeToString(h.Sum(nil))[:hashLen]
+
+	return fp, nil
+}
+
+// Diff returns descriptions of fixtures that differ between two fingerprints
+func (f *Fingerprint) Diff(old *Fingerprint) []string {
+	var diff []string
+	for name, h := range f.Fixtures {
+		oldHash, ok := old.Fixtures[name]
+		switch {
+		case !ok:
+			diff = append(diff, name+": added")
+		case oldHash != h:
+			diff = append(diff, name+": changed "+oldHash+" -> "+h)
+		}
+	}
+	for name := range old.Fixtures {
+		if _, ok := f.Fixtures[name]; !ok {
+			diff = append(diff, name+": removed")
+		}
+	}
+
+	sort.Strings(diff)
+	return diff
+}
+
+// CheckFingerprint compares a given fingerprint with the one stored in the file of a given path by the previous run
+// and warns if fixtures differ. Empty path disables the check
+func CheckFingerprint(path string, fp *Fingerprint) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		log.Debugf("fingerprint file %s does not exist, nothing to compare with", path)
+	case err != nil:
+		return errFingerprintFailed.Wrap(err, path)
+	default:
+		var old Fingerprint
+		if err := json.Unmarshal(data, &old); err != nil {
+			return errFingerprintFailed.Wrap(err, path)
+		}
+		if old.Corpus != fp.Corpus {
+			log.Warningf("fixtures differ from the ones used by the previous run(corpus %s -> %s), "+
+				"results are not comparable: %v", old.Corpus, fp.Corpus, fp.Diff(&old))
+		}
+	}
+	return nil
+}
+
+// SaveFingerprint writes a given fingerprint to the file of a given path, so the next run is compared with it.
+// It should be called after the results are stored, so failed runs do not replace the fingerprint.
+// Empty path disables it
+func SaveFingerprint(path string, fp *Fingerprint) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(fp, "", "  ")
+	if err != nil {
+		return errFingerprintFailed.Wrap(err, path)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return errFingerprintFailed.Wrap(err, path)
+	}
+	return nil
+}
+
+func hash(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])[:hashLen]
+}
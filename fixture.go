@@ -0,0 +1,48 @@
+package performance
+
+import (
+	"bytes"
+	"io/ioutil"
+)
+
+// Fixture represents the content of benchmarked file along with its size
+type Fixture struct {
+	// Path is a path to the fixture file
+	Path string
+	// Content is a content of the fixture file
+	Content string
+	// Bytes is a size of the fixture in bytes
+	Bytes int64
+	// Lines is an amount of lines in the fixture
+	Lines int64
+	// Hash is a hash of the fixture content
+	Hash string
+}
+
+// ReadFixture reads the file of a given path and measures its size
+func ReadFixture(path string) (*Fixture, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Fixture{
+		Path:    path,
+		Content: string(data),
+		Bytes:   int64(len(data)),
+		Lines:   countLines(data),
+		Hash:    hash(data),
+	}, nil
+}
+
+// countLines returns the amount of lines in data, last line is counted even if it's not terminated by a newline
+func countLines(data []byte) int64 {
+	if len(data) == 0 {
+		return 0
+	}
+	n := int64(bytes.Count(data, []byte{'\n'}))
+	if data[len(data)-1] != '\n' {
+		n++
+	}
+	return n
+}
@@ -11,12 +11,14 @@ require (
 	github.com/orourkedd/influxdb1-client v0.0.0-20190326200226-bd3b72602b58
 	github.com/ory/dockertest v3.3.4+incompatible
 	github.com/prometheus/client_golang v1.0.0
+	github.com/prometheus/common v0.4.1
 	github.com/spf13/cobra v0.0.5
 	github.com/src-d/envconfig v1.0.0
 	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4 // indirect
 	golang.org/x/net v0.0.0-20190628185345-da137c7871d7 // indirect
-	golang.org/x/sys v0.0.0-20190626221950-04f50cda93cb // indirect
+	golang.org/x/sys v0.0.0-20190626221950-04f50cda93cb
 	golang.org/x/tools v0.0.0-20190703212419-2214986f1668
+	google.golang.org/grpc v1.20.1
 	gopkg.in/src-d/go-errors.v1 v1.0.0
 	gopkg.in/src-d/go-log.v1 v1.0.2
 )
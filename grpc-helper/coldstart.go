@@ -0,0 +1,48 @@
+package grpc_helper
+
+import (
+	"context"
+	"time"
+
+	"github.com/bblfsh/performance"
+
+	bblfsh "github.com/bblfsh/go-client/v4"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// firstParseInterval is a delay between unsuccessful parse requests while waiting for the first successful one
+const firstParseInterval = 50 * time.Millisecond
+
+// WaitFirstParse connects to GRPC server of a given address and repeats parse request with a given fixture
+// until it succeeds or context is done. Returns the time passed since a given start time till the first
+// successful response.
+func WaitFirstParse(ctx context.Context, address, language string, fixture *performance.Fixture, start time.Time) (time.Duration, error) {
+	var lastErr error
+	for {
+		err := tryParse(ctx, address, language, fixture)
+		if err == nil {
+			return time.Since(start), nil
+		}
+		if lastErr == nil || err.Error() != lastErr.Error() {
+			log.Debugf("waiting for the first successful parse: %v", err)
+		}
+		lastErr = err
+
+		select {
+		case <-ctx.Done():
+			return 0, errGRPCClient.Wrap(lastErr)
+		case <-time.After(firstParseInterval):
+		}
+	}
+}
+
+func tryParse(ctx context.Context, address, language string, fixture *performance.Fixture) error {
+	client, err := bblfsh.NewClientContext(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	_, _, err = client.NewParseRequest().Context(ctx).Language(language).Content(fixture.Content).UAST()
+	return err
+}
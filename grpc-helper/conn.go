@@ -0,0 +1,126 @@
+package grpc_helper
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/bblfsh/performance"
+	"github.com/bblfsh/performance/storage"
+
+	bblfsh "github.com/bblfsh/go-client/v4"
+	protocol2 "github.com/bblfsh/sdk/v3/protocol"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/stats"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+const (
+	// compressionTag is a benchmark specific storage label that contains gRPC compression
+	compressionTag = "compression"
+	// CompressionNone disables gRPC compression
+	CompressionNone = "none"
+	// CompressionGzip enables gzip gRPC compression of requests and responses
+	CompressionGzip = "gzip"
+)
+
+var errInvalidCompression = errors.NewKind("invalid compression %v, supported: " + CompressionNone + ", " + CompressionGzip)
+
+// parseCompressions validates given compressions, if no compressions are given the connection is not compressed
+func parseCompressions(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return []string{CompressionNone}, nil
+	}
+	for _, n := range names {
+		if n != CompressionNone && encoding.GetCompressor(n) == nil {
+			return nil, errInvalidCompression.New(n)
+		}
+	}
+	return names, nil
+}
+
+// dial creates the client of GRPC server that uses a given compression and measures the size of messages
+func dial(ctx context.Context, address, compression string) (*bblfsh.Client, *wireStats, error) {
+	wire := &wireStats{}
+	opts := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.WithInsecure(),
+		grpc.WithStatsHandler(wire),
+	}
+	opts = append(opts, protocol2.DialOptions()...)
+	if compression != "" && compression != CompressionNone {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(compression)))
+	}
+
+	conn, err := grpc.DialContext(ctx, address, opts...)
+	if err != nil {
+		return nil, nil, errGRPCClient.Wrap(err)
+	}
+	client, err := bblfsh.NewClientWithConnectionContext(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, errGRPCClient.Wrap(err)
+	}
+	return client, wire, nil
+}
+
+// wireStats is a gRPC stats handler that sums sizes of sent and received messages
+type wireStats struct {
+	requestBytes      int64
+	requestWireBytes  int64
+	responseBytes     int64
+	responseWireBytes int64
+}
+
+// reset sets message sizes to zero
+func (w *wireStats) reset() {
+	atomic.StoreInt64(&w.requestBytes, 0)
+	atomic.StoreInt64(&w.requestWireBytes, 0)
+	atomic.StoreInt64(&w.responseBytes, 0)
+	atomic.StoreInt64(&w.responseWireBytes, 0)
+}
+
+// snapshot returns current message sizes, they are updated concurrently by the stats handler,
+// so they are read atomically
+func (w *wireStats) snapshot() wireSizes {
+	return wireSizes{
+		requestBytes:      atomic.LoadInt64(&w.requestBytes),
+		requestWireBytes:  atomic.LoadInt64(&w.requestWireBytes),
+		responseBytes:     atomic.LoadInt64(&w.responseBytes),
+		responseWireBytes: atomic.LoadInt64(&w.responseWireBytes),
+	}
+}
+
+// wireSizes contains the sizes of sent and received messages taken by wireStats.snapshot
+type wireSizes struct {
+	requestBytes      int64
+	requestWireBytes  int64
+	responseBytes     int64
+	responseWireBytes int64
+}
+
+// setMetrics stores message sizes as additional metrics of a given benchmark
+func (w wireSizes) setMetrics(b *performance.Benchmark) {
+	b.SetMetric(storage.RequestBytes, float64(w.requestBytes))
+	b.SetMetric(storage.RequestWireBytes, float64(w.requestWireBytes))
+	b.SetMetric(storage.ResponseBytes, float64(w.responseBytes))
+	b.SetMetric(storage.ResponseWireBytes, float64(w.responseWireBytes))
+}
+
+func (w *wireStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context { return ctx }
+
+func (w *wireStats) HandleRPC(_ context.Context, s stats.RPCStats) {
+	switch s := s.(type) {
+	case *stats.OutPayload:
+		atomic.AddInt64(&w.requestBytes, int64(s.Length))
+		atomic.AddInt64(&w.requestWireBytes, int64(s.WireLength))
+	case *stats.InPayload:
+		atomic.AddInt64(&w.responseBytes, int64(s.Length))
+		atomic.AddInt64(&w.responseWireBytes, int64(s.WireLength))
+	}
+}
+
+func (w *wireStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context { return ctx }
+
+func (w *wireStats) HandleConn(context.Context, stats.ConnStats) {}
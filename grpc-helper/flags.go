@@ -0,0 +1,65 @@
+package grpc_helper
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// AddFlags adds flags that configure the benchmarking process of BenchmarkGRPCAndStore to a given command
+func AddFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.Bool("fail-fast", false, "stop on the first failed file instead of storing its error and proceeding")
+	flags.Duration("request-timeout", 0, "timeout of a single parse request, 0 means no timeout")
+	flags.Int("retries", 0, "maximum amount of retries for timed out requests and requests failed with transient errors(Unavailable, ResourceExhausted)")
+	flags.Duration("retry-backoff", time.Second, "delay before the first retry, doubled for each next retry")
+	flags.StringSlice("modes", nil, "UAST modes to benchmark each file in(native, annotated, semantic), server's default mode is used if not set")
+	flags.StringSlice("compression", nil, "gRPC compressions to benchmark each file with("+CompressionNone+", "+CompressionGzip+"), connection is not compressed if not set")
+	flags.String("warmup", WarmUpFirst, "files used to warm up the driver("+WarmUpFirst+", "+WarmUpAll+", "+WarmUpNone+")")
+	flags.Int("warmup-iterations", 1, "minimal amount of warm up requests per file")
+	flags.Duration("warmup-duration", 0, "minimal duration of warm up per file")
+	flags.String("fingerprint-file", "", "file to keep fixtures fingerprint between runs, warns if fixtures have changed since the previous run")
+	flags.Bool("skip-decode", false, "do not decode UAST of responses in the benchmark loop, so the time per operation excludes the client decoding")
+}
+
+// ParseFlags fills benchmarking options of meta using the flags added by AddFlags
+func (meta *BenchmarkGRPCMeta) ParseFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	meta.FailFast, _ = flags.GetBool("fail-fast")
+	meta.RequestTimeout, _ = flags.GetDuration("request-timeout")
+	meta.Retry.Retries, _ = flags.GetInt("retries")
+	meta.Retry.Backoff, _ = flags.GetDuration("retry-backoff")
+	meta.Modes, _ = flags.GetStringSlice("modes")
+	meta.Compressions, _ = flags.GetStringSlice("compression")
+	meta.WarmUp.Strategy, _ = flags.GetString("warmup")
+	meta.WarmUp.Iterations, _ = flags.GetInt("warmup-iterations")
+	meta.WarmUp.Duration, _ = flags.GetDuration("warmup-duration")
+	meta.FingerprintFile, _ = flags.GetString("fingerprint-file")
+	meta.SkipDecode, _ = flags.GetBool("skip-decode")
+}
+
+// AddSweepFlags adds flags that configure the concurrency sweep of BenchmarkSweepAndStore to a given command
+func AddSweepFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.Bool("sweep", false, "repeat concurrent benchmark over a single connection with concurrency 1, 2, 4, ... and the limit and detect the saturation point, cannot be combined with --mixed, --modes, --compression and --detect-language")
+	flags.Int("max-concurrency", 32, "upper limit of concurrent clients for the concurrency sweep, it is always the last step")
+	flags.Duration("step-duration", 30*time.Second, "duration of each step of the concurrency sweep")
+	flags.Float64("scaling-threshold", 1.1, "minimal ratio of throughput to the throughput of the previous step that is considered as scaling when concurrency is doubled, it is scaled down for smaller increase")
+	flags.Float64("latency-threshold", 3, "maximal ratio of p99 latency to p99 latency with a single client")
+}
+
+// ParseSweepFlags returns the concurrency sweep configured by the flags added by AddSweepFlags
+// and reports whether the sweep is enabled, the flags are validated only if the sweep is enabled
+func ParseSweepFlags(cmd *cobra.Command) (Sweep, bool, error) {
+	flags := cmd.Flags()
+	var s Sweep
+	enabled, _ := flags.GetBool("sweep")
+	s.MaxConcurrency, _ = flags.GetInt("max-concurrency")
+	s.StepDuration, _ = flags.GetDuration("step-duration")
+	s.ScalingThreshold, _ = flags.GetFloat64("scaling-threshold")
+	s.LatencyThreshold, _ = flags.GetFloat64("latency-threshold")
+	if !enabled {
+		return s, false, nil
+	}
+	return s, true, s.validate()
+}
@@ -2,8 +2,7 @@ package grpc_helper
 
 import (
 	"context"
-	"io/ioutil"
-	"testing"
+	"path/filepath"
 	"time"
 
 	"github.com/bblfsh/performance"
@@ -14,10 +13,23 @@ import (
 	"gopkg.in/src-d/go-log.v1"
 )
 
+const (
+	// modeTag is a benchmark specific storage label that contains UAST mode
+	modeTag = "mode"
+	// detectionTag is a benchmark specific storage label that shows if the language was set explicitly or detected by the server
+	detectionTag = "language_detection"
+
+	detectionExplicit = "explicit"
+	detectionAuto     = "auto"
+
+	// decodeTag is a storage label that shows if UAST of responses was decoded in the benchmark loop
+	decodeTag     = "uast_decode"
+	decodeSkipped = "skipped"
+)
+
 var (
 	errGRPCClient      = errors.NewKind("cannot get grpc client")
 	errGetFiles        = errors.NewKind("cannot get files")
-	errBenchmark       = errors.NewKind("cannot perform benchmark over the file %v: %v")
 	errNoFilesDetected = errors.NewKind("no files detected")
 	errWarmUpFailed    = errors.NewKind("warmup for file %v has failed: %v")
 )
@@ -44,20 +56,66 @@ type BenchmarkGRPCMeta struct {
 	Level string
 	// Storage represents storage type to be used
 	Storage string
+	// FailFast stops the benchmarks on the first failed fixture, otherwise failed fixtures are stored with their errors
+	FailFast bool
+	// RequestTimeout is a timeout of a single parse request, 0 means no timeout
+	RequestTimeout time.Duration
+	// Retry defines how requests failed with transient errors are retried
+	Retry RetryPolicy
+	// Modes is a list of UAST modes(native, annotated, semantic) each file is benchmarked in,
+	// if empty the default mode of the server is used. Mode is used as a label for storage
+	Modes []string
+	// Compressions is a list of gRPC compressions(none, gzip) each file is benchmarked with,
+	// if empty the connection is not compressed. Compression is always used as a label for storage
+	Compressions []string
+	// WarmUp defines how the driver is warmed up before the benchmarks
+	WarmUp WarmUp
+	// SkipDecode does not decode UAST of responses in the benchmark loop, so the client overhead is excluded from
+	// the time per operation. The first request for each file is still decoded to get UAST metrics
+	SkipDecode bool
+	// DetectLanguage additionally benchmarks each file with requests that have only a filename and no language,
+	// so the server has to detect the language, and stores the detection overhead. The benchmark of the file fails
+	// if the detected language differs from Language
+	DetectLanguage bool
+	// Resources samples resource usage of the benchmarked container, nil disables the sampling
+	Resources performance.ResourceSampler
+	// CPU reads CPU accounting of the benchmarked container to measure CPU time per operation, nil disables it
+	CPU performance.CPUCounter
+	// ServerMetrics reads metrics of the server, changes of cumulative ones per operation and values of gauges
+	// before and after the benchmark of each file are stored, nil disables it
+	ServerMetrics MetricsScraper
+	// Profiler captures profiles of the server after the benchmark of each file while its requests are replayed
+	// for the duration of the measured round, nil disables profiling
+	Profiler Profiler
+	// Environment contains tags that describe the environment of the run, they are added to storage tags
+	Environment map[string]string
+	// FingerprintFile is a path to the file with fixtures fingerprint of the previous run, it's used to warn
+	// if fixtures have changed since then and is overwritten with the current fingerprint once the results of
+	// a complete run are stored. Empty path disables the check
+	FingerprintFile string
 }
 
 // BenchmarkGRPCAndStore performs steps
 // 1) creates client to GRPC server
 // 2) filters files from a given directories
-// 3) runs warm up request
-// 4) runs benchmarks using the filtered files
-// 5) stores results to a given storage
+// 3) for each of gRPC compressions, UAST modes and each of the filtered files measures the latency of the first request
+// 4) warms up the driver according to the warm up strategy
+// 5) runs benchmarks using the filtered files, failed files are marked with their errors unless FailFast is set
+// 6) if language detection is enabled, benchmarks each file once more letting the server detect the language
+// 7) stores results to a given storage, if the context is cancelled benchmarks stop, the interrupted file is skipped
+// and the completed ones are stored marked as partial
 func BenchmarkGRPCAndStore(ctx context.Context, meta BenchmarkGRPCMeta) error {
-	client, err := bblfsh.NewClientContext(ctx, meta.Address)
+	modes, err := parseModes(meta.Modes)
 	if err != nil {
-		return errGRPCClient.Wrap(err)
+		return err
+	}
+	compressions, err := parseCompressions(meta.Compressions)
+	if err != nil {
+		return err
+	}
+	if err := meta.WarmUp.validate(); err != nil {
+		return err
 	}
-	defer client.Close()
 
 	files, err := performance.GetFiles(meta.FilterPrefix, meta.ExcludeSubstrings, meta.Dirs...)
 	if err != nil {
@@ -66,22 +124,50 @@ func BenchmarkGRPCAndStore(ctx context.Context, meta BenchmarkGRPCMeta) error {
 		return errNoFilesDetected.New()
 	}
 
-	warmUpFile := files[0]
-	log.Debugf("🔥warming up the language %s using file %s", meta.Language, warmUpFile)
-	warmUpTime, err := warmUpDriver(ctx, client, meta.Language, warmUpFile)
+	fingerprint, err := performance.NewFingerprint(files)
 	if err != nil {
-		return errWarmUpFailed.New(warmUpFile, err)
+		return errGetFiles.Wrap(err)
+	}
+	if err := performance.CheckFingerprint(meta.FingerprintFile, fingerprint); err != nil {
+		return err
 	}
-	log.Debugf("warm up done for file %s in %v", warmUpFile, warmUpTime)
 
-	var benchmarks []performance.Benchmark
-	for _, f := range files {
-		log.Debugf("benching file: %s", f)
-		bRes, err := benchFile(ctx, client, meta.Language, f)
+	runs := len(compressions) * len(modes) * len(files)
+	if meta.DetectLanguage {
+		runs *= 2
+	}
+	progress := performance.NewProgress(runs)
+
+	var (
+		benchmarks []performance.Benchmark
+		partial    bool
+	)
+	for _, c := range compressions {
+		if ctx.Err() != nil {
+			partial = true
+			break
+		}
+		client, wire, err := dial(ctx, meta.Address, c)
 		if err != nil {
-			return errBenchmark.New(f, err)
+			return err
+		}
+
+		req := newRequester(client, wire, meta)
+		res, interrupted, err := benchFiles(ctx, meta, req, progress, modes, files, c)
+		client.Close()
+		if err != nil {
+			progress.Finish()
+			return err
+		}
+		benchmarks = append(benchmarks, res...)
+		if interrupted {
+			partial = true
+			break
 		}
-		benchmarks = append(benchmarks, performance.BenchmarkResultToBenchmark(f, bRes, meta.FilterPrefix))
+	}
+	progress.Finish()
+	if failed := performance.CountFailed(benchmarks); failed > 0 {
+		log.Warningf("%d of %d files have failed", failed, len(benchmarks))
 	}
 
 	// store data
@@ -91,36 +177,263 @@ func BenchmarkGRPCAndStore(ctx context.Context, meta BenchmarkGRPCMeta) error {
 	}
 	defer storageClient.Close()
 
-	return storageClient.Dump(map[string]string{
+	if err := storageClient.Dump(performance.PartialTags(partial, performance.MergeTags(map[string]string{
 		"language": meta.Language,
 		"commit":   meta.Commit,
 		"level":    meta.Level,
-	}, benchmarks...)
+
+		performance.CorpusHashTag: fingerprint.Corpus,
+	}, meta.runTags())), storage.WithHostMetrics(benchmarks)...); err != nil {
+		return err
+	}
+	return meta.saveFingerprint(partial, fingerprint)
 }
 
-func warmUpDriver(ctx context.Context, c *bblfsh.Client, language string, path string) (time.Duration, error) {
-	data, err := ioutil.ReadFile(path)
+// benchFiles performs benchmarks over given files in each of UAST modes using a given requester,
+// results are tagged by mode and compression. Each benchmark is reported to a given progress.
+// If the context is cancelled, the completed benchmarks are returned and the run is reported as interrupted
+func benchFiles(ctx context.Context, meta BenchmarkGRPCMeta, req *requester, progress *performance.Progress,
+	modes []mode, files []string, compression string) ([]performance.Benchmark, bool, error) {
+	setTags := func(b *performance.Benchmark, m mode) {
+		if m.name != "" {
+			b.SetTag(modeTag, m.name)
+		}
+		b.SetTag(compressionTag, compression)
+	}
+
+	var benchmarks []performance.Benchmark
+	for _, m := range modes {
+		req.mode = m
+		for i, f := range files {
+			if ctx.Err() != nil {
+				return benchmarks, true, nil
+			}
+
+			log.Debugf("benching file: %s, mode: %q, compression: %q", f, m.name, compression)
+			progress.Start(filepath.Base(f))
+			bench, err := benchFile(ctx, meta, req, f, profileName(meta, f, m, compression, false), meta.WarmUp.required(i))
+			progress.Done()
+			if err != nil && ctx.Err() != nil {
+				log.Warningf("benchmark over the file %s was interrupted", f)
+				return benchmarks, true, nil
+			}
+			setTags(&bench, m)
+			if err := performance.CheckFailure(f, err, meta.FailFast); err != nil {
+				return nil, false, err
+			}
+			if meta.DetectLanguage {
+				bench.SetTag(detectionTag, detectionExplicit)
+			}
+			benchmarks = append(benchmarks, bench)
+
+			if !meta.DetectLanguage {
+				continue
+			}
+
+			log.Debugf("benching file: %s, mode: %q, compression: %q with language detection", f, m.name, compression)
+			progress.Start(filepath.Base(f))
+			req.detectLanguage = true
+			auto, err := benchFile(ctx, meta, req, f, profileName(meta, f, m, compression, true), false)
+			req.detectLanguage = false
+			progress.Done()
+			if err != nil && ctx.Err() != nil {
+				log.Warningf("benchmark over the file %s with language detection was interrupted", f)
+				return benchmarks, true, nil
+			}
+			setTags(&auto, m)
+			auto.SetTag(detectionTag, detectionAuto)
+			if err := performance.CheckFailure(f+" with language detection", err, meta.FailFast); err != nil {
+				return nil, false, err
+			}
+			if !auto.Failed() && !bench.Failed() {
+				auto.SetMetric(storage.DetectionOverheadSeconds, (auto.Benchmark.NsPerOp-bench.Benchmark.NsPerOp)/1e9)
+			}
+			benchmarks = append(benchmarks, auto)
+		}
+	}
+	return benchmarks, false, nil
+}
+
+// benchFile performs benchmark over the file of a given path, if benchmark fails then the error is returned
+// along with the failed benchmark, so it can be stored.
+// The first request for the file is measured separately, its UAST and messages are used to get the size metrics.
+// Resource usage of the container is sampled, its CPU time and server metrics per operation are measured and
+// its profiles are captured under a given name after the benchmark if the corresponding options of meta are set.
+func benchFile(ctx context.Context, meta BenchmarkGRPCMeta, req *requester, path, profile string, doWarmUp bool) (performance.Benchmark, error) {
+	defer performance.Trace(performance.TraceCategoryPhase, profile, map[string]string{"file": path})()
+	trimPrefix := meta.FilterPrefix
+	fixture, err := performance.ReadFixture(path)
 	if err != nil {
-		return 0, err
+		return performance.FailedBenchmark(path, err, trimPrefix), err
 	}
 
+	req.reset()
+	fail := func(err error) (performance.Benchmark, error) {
+		bench := performance.FailedBenchmark(path, err, trimPrefix)
+		req.setMetrics(&bench)
+		return bench, err
+	}
+
+	req.wire.reset()
+	skipDecode := req.skipDecode
+	req.skipDecode = false
 	start := time.Now()
-	_, _, err = c.NewParseRequest().Context(ctx).Language(language).Content(string(data)).UAST()
+	n, err := req.parse(ctx, fixture)
+	req.skipDecode = skipDecode
+	if err != nil {
+		return fail(err)
+	}
+	cold := time.Since(start)
+	wire := req.wire.snapshot()
 
-	return time.Since(start), err
-}
+	if doWarmUp {
+		if err := meta.WarmUp.run(ctx, req, fixture); err != nil {
+			return fail(err)
+		}
+	}
 
-func benchFile(ctx context.Context, c *bblfsh.Client, language string, path string) (*testing.BenchmarkResult, error) {
-	data, err := ioutil.ReadFile(path)
+	if meta.Resources != nil {
+		meta.Resources.Reset()
+	}
+	cpu := newCPUMeter(ctx, meta.CPU)
+	server := newMetricsMeter(ctx, meta.ServerMetrics)
+	req.resetTiming()
+	var calls int
+	endLoop := performance.Trace(performance.TraceCategoryPhase, "benchmark loop", nil)
+	// request counters are stored for the last round only, so they match the stored amount of operations
+	res, err := performance.BenchRounds(fixture.Bytes, func(t performance.BenchTimer) {
+		req.reset()
+		req.timer = t
+	}, func() error {
+		calls++
+		_, err := req.parse(ctx, fixture)
+		return err
+	})
+	req.timer = nil
+	endLoop()
 	if err != nil {
-		return nil, err
+		return fail(err)
 	}
+	cpuPerOp, cpuErr := cpu.perOp(ctx, calls)
+	serverMetrics, serverErr := server.measure(ctx, calls)
 
-	res := testing.Benchmark(performance.Bench(func() {
-		_, _, err := c.NewParseRequest().Context(ctx).Language(language).Content(string(data)).UAST()
-		if err != nil {
-			panic(err)
+	bench := performance.FixtureBenchmark(fixture, res, trimPrefix)
+	// allocations are measured in this process, so they are the ones of the client and not of the server
+	storage.SetClientAllocs(&bench)
+	req.setTimingMetrics(&bench, calls)
+	bench.SetMetric(storage.ColdSeconds, cold.Seconds())
+	wire.setMetrics(&bench)
+	setUASTMetrics(fixture, n, &bench)
+	if meta.Resources != nil {
+		storage.SetResourceMetrics(&bench, meta.Resources.Collect())
+	}
+	if cpuErr != nil {
+		log.Warningf("cannot measure CPU usage of the file %s: %v", fixture.Path, cpuErr)
+	} else if meta.CPU != nil {
+		bench.SetMetric(storage.PerOpCPUSeconds, cpuPerOp.Seconds())
+	}
+	if serverErr != nil {
+		log.Warningf("cannot measure server metrics of the file %s: %v", fixture.Path, serverErr)
+	} else {
+		storage.SetServerMetrics(&bench, serverMetrics)
+	}
+	req.setMetrics(&bench)
+
+	if meta.Profiler != nil {
+		if err := profileFile(ctx, meta.Profiler, req, fixture, profile, res.T); err != nil {
+			log.Warningf("cannot capture profiles of the file %s: %v", fixture.Path, err)
+		}
+	}
+	return bench, nil
+}
+
+// profileFile captures profiles of the server under a given name while requests with a given fixture are replayed
+// for the duration of the measured round of its benchmark. It's done after the benchmark, so profiling affects
+// neither the measurements nor the time the benchmark takes
+func profileFile(ctx context.Context, profiler Profiler, req *requester, fixture *performance.Fixture, name string,
+	loop time.Duration) error {
+	defer performance.Trace(performance.TraceCategoryPhase, "profiling", nil)()
+	// the fetch of profiles is cancelled if the replay fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	d := profileDuration(loop)
+	stop := profiler.Start(ctx, name, d)
+	for start := time.Now(); time.Since(start) < d; {
+		if _, err := req.parse(ctx, fixture); err != nil {
+			return err
+		}
+	}
+	return stop()
+}
+
+// runTags returns storage tags that describe the environment and options of the run
+func (meta BenchmarkGRPCMeta) runTags() map[string]string {
+	tags := make(map[string]string, len(meta.Environment)+1)
+	for k, v := range meta.Environment {
+		tags[k] = v
+	}
+	if meta.SkipDecode {
+		tags[decodeTag] = decodeSkipped
+	}
+	return tags
+}
+
+// saveFingerprint keeps a given fingerprint for the next run unless the run was interrupted
+func (meta BenchmarkGRPCMeta) saveFingerprint(partial bool, fp *performance.Fingerprint) error {
+	if partial {
+		return nil
+	}
+	return performance.SaveFingerprint(meta.FingerprintFile, fp)
+}
+
+// profileName returns the name of profiles of the benchmark over a given file, it includes the options of the benchmark
+func profileName(meta BenchmarkGRPCMeta, path string, m mode, compression string, detectLanguage bool) string {
+	name := performance.ParseBenchmarkName(path, meta.FilterPrefix)
+	for _, s := range []string{m.name, compression} {
+		if s != "" {
+			name += "_" + s
 		}
-	}))
-	return &res, nil
+	}
+	if detectLanguage {
+		name += "_" + detectionAuto
+	}
+	return name
+}
+
+// setUASTMetrics stores the size of a given UAST to benchmark metrics
+func setUASTMetrics(fixture *performance.Fixture, n bblfsh.Node, bench *performance.Benchmark) {
+	stats, err := performance.NewUASTStats(n)
+	if err != nil {
+		log.Warningf("cannot measure UAST of the file %s: %v", fixture.Path, err)
+		return
+	}
+	storage.SetUASTMetrics(bench, stats)
+}
+
+// cpuMeter measures CPU time consumed by the container between its creation and perOp call
+type cpuMeter struct {
+	counter performance.CPUCounter
+	start   time.Duration
+	err     error
+}
+
+func newCPUMeter(ctx context.Context, counter performance.CPUCounter) *cpuMeter {
+	m := &cpuMeter{counter: counter}
+	if counter != nil {
+		m.start, m.err = counter.CPUUsage(ctx)
+	}
+	return m
+}
+
+// perOp returns CPU time consumed since the meter creation divided by a given amount of operations
+func (m *cpuMeter) perOp(ctx context.Context, ops int) (time.Duration, error) {
+	if m.counter == nil || m.err != nil || ops == 0 {
+		return 0, m.err
+	}
+	end, err := m.counter.CPUUsage(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return (end - m.start) / time.Duration(ops), nil
 }
@@ -0,0 +1,220 @@
+package grpc_helper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bblfsh/performance"
+	"github.com/bblfsh/performance/storage"
+
+	bblfsh "github.com/bblfsh/go-client/v4"
+	"golang.org/x/tools/benchmark/parse"
+)
+
+// allLanguages is a value of language tag for the results aggregated over all languages
+const allLanguages = "all"
+
+// request is a single parse request of replayed load
+type request struct {
+	language string
+	fixture  *performance.Fixture
+}
+
+// loadResult collects latencies of successful requests and amounts of failed ones grouped by language
+type loadResult struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	failures  map[string]int
+	timeouts  int
+	retries   int
+	elapsed   time.Duration
+}
+
+func newLoadResult() *loadResult {
+	return &loadResult{
+		latencies: make(map[string][]time.Duration),
+		failures:  make(map[string]int),
+	}
+}
+
+func (r *loadResult) add(language string, latency time.Duration, err error) {
+	if err != nil {
+		r.failures[language]++
+		return
+	}
+	r.latencies[language] = append(r.latencies[language], latency)
+}
+
+func (r *loadResult) merge(o *loadResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for l, lat := range o.latencies {
+		r.latencies[l] = append(r.latencies[l], lat...)
+	}
+	for l, n := range o.failures {
+		r.failures[l] += n
+	}
+	r.timeouts += o.timeouts
+	r.retries += o.retries
+}
+
+// interrupted reports whether the replay has stopped before a given duration passed
+func (r *loadResult) interrupted(duration time.Duration) bool {
+	return r.elapsed < duration
+}
+
+// failed returns the total amount of failed requests
+func (r *loadResult) failed() int {
+	var n int
+	for _, f := range r.failures {
+		n += f
+	}
+	return n
+}
+
+// aggregate returns the benchmark of a given name over the requests of all languages
+func (r *loadResult) aggregate(name string) performance.Benchmark {
+	var all []time.Duration
+	for _, lat := range r.latencies {
+		all = append(all, lat...)
+	}
+
+	bench := r.benchmark(name, all, r.failed())
+	bench.SetMetric(storage.Timeouts, float64(r.timeouts))
+	bench.SetMetric(storage.Retries, float64(r.retries))
+	return bench
+}
+
+// benchmarks returns benchmarks of a given name for each language tagged by language along with the aggregated one
+func (r *loadResult) benchmarks(name string) []performance.Benchmark {
+	languages := make(map[string]string)
+	for l := range r.latencies {
+		languages[l] = ""
+	}
+	for l := range r.failures {
+		languages[l] = ""
+	}
+	names, _ := performance.SplitStringMap(languages)
+
+	var res []performance.Benchmark
+	for _, l := range names {
+		bench := r.benchmark(name, r.latencies[l], r.failures[l])
+		bench.SetTag("language", l)
+		res = append(res, bench)
+	}
+
+	bench := r.aggregate(name)
+	bench.SetTag("language", allLanguages)
+	return append(res, bench)
+}
+
+func (r *loadResult) benchmark(name string, latencies []time.Duration, failures int) performance.Benchmark {
+	stats := performance.NewLatencyStats(latencies)
+	bench := performance.NewBenchmark(&parse.Benchmark{
+		Name:     name,
+		N:        stats.Count,
+		NsPerOp:  float64(stats.Mean),
+		Measured: parse.NsPerOp,
+	})
+	bench.SetMetric(storage.P50Seconds, stats.P50.Seconds())
+	bench.SetMetric(storage.P90Seconds, stats.P90.Seconds())
+	bench.SetMetric(storage.P99Seconds, stats.P99.Seconds())
+	bench.SetMetric(storage.RequestsPerSecond, float64(stats.Count)/r.elapsed.Seconds())
+	bench.SetMetric(storage.FailedRequests, float64(failures))
+	return bench
+}
+
+// replay sends requests produced by next using a given amount of concurrent workers until duration passes.
+// Every worker uses its own requester per language, so per-request timeout and retry policy of meta are applied.
+// Workers share the connection of a given client, so their requests are multiplexed as concurrent gRPC streams
+func replay(ctx context.Context, client *bblfsh.Client, meta BenchmarkGRPCMeta, concurrency int,
+	duration time.Duration, next func() request) *loadResult {
+	res := newLoadResult()
+	start := time.Now()
+	deadline := start.Add(duration)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			local := newLoadResult()
+			requesters := make(map[string]*requester)
+			for time.Now().Before(deadline) && ctx.Err() == nil {
+				r := next()
+				req, ok := requesters[r.language]
+				if !ok {
+					m := meta
+					m.Language = r.language
+					req = newRequester(client, nil, m)
+					requesters[r.language] = req
+				}
+
+				t := time.Now()
+				_, err := req.parse(ctx, r.fixture)
+				if err != nil && ctx.Err() != nil {
+					// interrupted request is not a failure
+					break
+				}
+				local.add(r.language, time.Since(t), err)
+			}
+			for _, req := range requesters {
+				local.timeouts += req.timeouts
+				local.retries += req.retries
+			}
+			res.merge(local)
+		}()
+	}
+	wg.Wait()
+
+	res.elapsed = time.Since(start)
+	return res
+}
+
+// readFixtures reads the files filtered from the directories of meta and checks their fingerprint,
+// the fingerprint is returned, so it can be saved once the results are stored
+func readFixtures(meta BenchmarkGRPCMeta) ([]*performance.Fixture, *performance.Fingerprint, error) {
+	files, err := performance.GetFiles(meta.FilterPrefix, meta.ExcludeSubstrings, meta.Dirs...)
+	if err != nil {
+		return nil, nil, errGetFiles.Wrap(err)
+	} else if len(files) == 0 {
+		return nil, nil, errNoFilesDetected.New()
+	}
+
+	fingerprint, err := performance.NewFingerprint(files)
+	if err != nil {
+		return nil, nil, errGetFiles.Wrap(err)
+	}
+	if err := performance.CheckFingerprint(meta.FingerprintFile, fingerprint); err != nil {
+		return nil, nil, err
+	}
+
+	fixtures := make([]*performance.Fixture, 0, len(files))
+	for _, f := range files {
+		fixture, err := performance.ReadFixture(f)
+		if err != nil {
+			return nil, nil, errGetFiles.Wrap(err)
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, fingerprint, nil
+}
+
+// cycle returns the generator of requests of a given language that takes given fixtures in turn,
+// it's safe for concurrent use
+func cycle(language string, fixtures []*performance.Fixture) func() request {
+	var (
+		mu  sync.Mutex
+		pos int
+	)
+	return func() request {
+		mu.Lock()
+		defer mu.Unlock()
+		f := fixtures[pos%len(fixtures)]
+		pos++
+		return request{language: language, fixture: f}
+	}
+}
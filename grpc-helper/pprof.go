@@ -0,0 +1,121 @@
+package grpc_helper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bblfsh/performance"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var errFetchProfile = errors.NewKind("cannot fetch %v profile: %v")
+
+// Profiler captures profiles of the benchmarked server
+type Profiler interface {
+	// Start starts profiling of the benchmark of a given name, CPU is profiled for a given duration.
+	// The returned function waits for CPU profile, stores it along with the rest of profiles
+	Start(ctx context.Context, name string, cpu time.Duration) (stop func() error)
+}
+
+// profileDuration rounds a given duration of CPU profile up to seconds, as pprof endpoint accepts only seconds
+func profileDuration(d time.Duration) time.Duration {
+	if d < time.Second {
+		return time.Second
+	}
+	return (d + time.Second - 1) / time.Second * time.Second
+}
+
+// PprofProfiler fetches profiles of Go servers that expose net/http/pprof endpoint and stores them to a directory.
+// CPU profile is taken for a given duration from the start, the rest of profiles are taken after it
+type PprofProfiler struct {
+	// Address is a host:port of the pprof endpoint
+	Address string
+	// Dir is a directory to store profiles
+	Dir string
+	// Kinds is a list of profiles to fetch(cpu, heap, allocs, mutex)
+	Kinds []string
+}
+
+// NewPprofProfiler validates profile kinds and creates the directory for profiles
+func NewPprofProfiler(address, dir string, kinds []string) (*PprofProfiler, error) {
+	if err := performance.ValidateProfiles(kinds); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &PprofProfiler{Address: address, Dir: dir, Kinds: kinds}, nil
+}
+
+// Start implements Profiler
+func (p *PprofProfiler) Start(ctx context.Context, name string, duration time.Duration) func() error {
+	cpu := make(chan error, 1)
+	if p.has(performance.ProfileCPU) {
+		seconds := int(profileDuration(duration) / time.Second)
+		go func() {
+			cpu <- p.fetch(ctx, name, performance.ProfileCPU, fmt.Sprintf("profile?seconds=%d", seconds))
+		}()
+	} else {
+		cpu <- nil
+	}
+
+	return func() error {
+		if err := <-cpu; err != nil {
+			return err
+		}
+		for _, k := range p.Kinds {
+			path := k
+			switch k {
+			case performance.ProfileCPU:
+				continue
+			case performance.ProfileHeap:
+				// heap profile shows the state as of the last GC
+				path += "?gc=1"
+			}
+			if err := p.fetch(ctx, name, k, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (p *PprofProfiler) has(kind string) bool {
+	for _, k := range p.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// fetch stores the profile of a given kind that is served on a given path relative to /debug/pprof/
+func (p *PprofProfiler) fetch(ctx context.Context, name, kind, path string) error {
+	req, err := http.NewRequest(http.MethodGet, "http://"+p.Address+"/debug/pprof/"+path, nil)
+	if err != nil {
+		return errFetchProfile.New(kind, err)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errFetchProfile.New(kind, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errFetchProfile.New(kind, resp.Status)
+	}
+
+	f, err := os.Create(performance.ProfilePath(p.Dir, name, kind))
+	if err != nil {
+		return errFetchProfile.New(kind, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return errFetchProfile.New(kind, err)
+	}
+	return nil
+}
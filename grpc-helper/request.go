@@ -0,0 +1,243 @@
+package grpc_helper
+
+import (
+	"context"
+	goerrors "errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bblfsh/performance"
+	"github.com/bblfsh/performance/storage"
+
+	bblfsh "github.com/bblfsh/go-client/v4"
+	"github.com/bblfsh/sdk/v3/driver"
+	"github.com/bblfsh/sdk/v3/protocol"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	errRequestTimeout = errors.NewKind("request has timed out after %v")
+	errWrongLanguage  = errors.NewKind("server has detected language %v instead of %v")
+	errInvalidMode    = errors.NewKind("invalid UAST mode %v: %v")
+)
+
+// mode is a UAST mode of parse requests, empty name stands for the default mode of the server
+type mode struct {
+	name string
+	mode bblfsh.Mode
+}
+
+// parseModes parses given UAST mode names, if no names are given the default mode is used
+func parseModes(names []string) ([]mode, error) {
+	if len(names) == 0 {
+		return []mode{{}}, nil
+	}
+
+	modes := make([]mode, 0, len(names))
+	for _, n := range names {
+		m, err := bblfsh.ParseMode(n)
+		if err != nil {
+			return nil, errInvalidMode.New(n, err)
+		}
+		modes = append(modes, mode{name: n, mode: m})
+	}
+	return modes, nil
+}
+
+// RetryPolicy defines how parse requests failed with transient errors or timed out are retried
+type RetryPolicy struct {
+	// Retries is the maximum amount of retries per request, 0 disables retries
+	Retries int
+	// Backoff is a delay before the first retry, it's doubled for each next retry
+	Backoff time.Duration
+}
+
+// requester performs parse requests of a given language applying per-request timeout and retry policy,
+// it also counts timed out and retried requests since the last reset
+type requester struct {
+	client   *bblfsh.Client
+	language string
+	timeout  time.Duration
+	retry    RetryPolicy
+	mode     mode
+	// wire is the stats handler of the client connection, nil if message sizes are not measured
+	wire *wireStats
+	// detectLanguage sends requests with a filename and without a language, so the server has to detect it
+	detectLanguage bool
+	// skipDecode does not decode UAST of responses, so parse returns no UAST
+	skipDecode bool
+	// timer is the timer of the running benchmark, it's stopped during retry backoff, so the backoff is not
+	// measured. Nil if requests are not performed by the benchmark
+	timer performance.BenchTimer
+
+	timeouts int
+	retries  int
+	// rpc and decode are total durations of request round-trips and UAST decoding since the last resetTiming
+	rpc    time.Duration
+	decode time.Duration
+}
+
+func newRequester(c *bblfsh.Client, wire *wireStats, meta BenchmarkGRPCMeta) *requester {
+	return &requester{
+		client:   c,
+		wire:     wire,
+		language: meta.Language,
+		timeout:  meta.RequestTimeout,
+		retry:    meta.Retry,
+
+		skipDecode: meta.SkipDecode,
+	}
+}
+
+// parse sends parse request with the content of a given fixture and returns the UAST,
+// transient errors and timed out requests are retried according to the retry policy
+func (r *requester) parse(ctx context.Context, fixture *performance.Fixture) (bblfsh.Node, error) {
+	defer performance.TraceRequest(filepath.Base(fixture.Path))()
+	backoff := r.retry.Backoff
+	for attempt := 0; ; attempt++ {
+		n, err := r.parseOnce(ctx, fixture)
+		if err == nil || attempt >= r.retry.Retries || !isRetriable(err) {
+			return n, err
+		}
+
+		r.retries++
+		if err := r.sleep(ctx, backoff); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// sleep waits for a given backoff with the benchmark timer stopped
+func (r *requester) sleep(ctx context.Context, backoff time.Duration) error {
+	if r.timer != nil {
+		r.timer.StopTimer()
+		defer r.timer.StartTimer()
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(backoff):
+		return nil
+	}
+}
+
+func (r *requester) parseOnce(ctx context.Context, fixture *performance.Fixture) (bblfsh.Node, error) {
+	rctx := ctx
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		rctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	req := r.client.NewParseRequest().Context(rctx).Content(fixture.Content)
+	if r.detectLanguage {
+		req = req.Filename(filepath.Base(fixture.Path))
+	} else {
+		req = req.Language(r.language)
+	}
+	if r.mode.name != "" {
+		req = req.Mode(r.mode.mode)
+	}
+
+	// round-trip and decoding are measured separately, so the client overhead is not attributed to the server
+	start := time.Now()
+	resp, err := req.Do()
+	r.rpc += time.Since(start)
+	if err != nil && ctx.Err() == nil && rctx.Err() == context.DeadlineExceeded {
+		r.timeouts++
+		return nil, errRequestTimeout.New(r.timeout)
+	} else if err != nil {
+		return nil, rpcError(err)
+	}
+	// misdetected file is parsed by another driver, so its timing is meaningless
+	if r.detectLanguage && !strings.EqualFold(resp.Language, r.language) {
+		return nil, errWrongLanguage.New(resp.Language, r.language)
+	}
+
+	if r.skipDecode {
+		return nil, responseError(resp)
+	}
+	start = time.Now()
+	n, err := resp.Nodes()
+	r.decode += time.Since(start)
+	return n, err
+}
+
+// rpcError converts status errors of the parse request to driver errors the same way the client does
+func rpcError(err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	var kind *errors.Kind
+	switch s.Code() {
+	case codes.Internal:
+		kind = driver.ErrDriverFailure
+	case codes.FailedPrecondition:
+		kind = driver.ErrTransformFailure
+	case codes.InvalidArgument:
+		kind = driver.ErrModeNotSupported
+	default:
+		return err
+	}
+	return kind.Wrap(goerrors.New(s.Message()))
+}
+
+// responseError returns syntax errors of a given response without decoding its UAST
+func responseError(resp *protocol.ParseResponse) error {
+	if len(resp.Errors) == 0 {
+		return nil
+	}
+	var errs []error
+	for _, e := range resp.Errors {
+		errs = append(errs, goerrors.New(e.Text))
+	}
+	return driver.ErrSyntax.Wrap(driver.JoinErrors(errs))
+}
+
+// reset sets request counters to zero, it should be called at the start of each benchmark round,
+// so the counters match the stored round
+func (r *requester) reset() {
+	r.timeouts = 0
+	r.retries = 0
+}
+
+// resetTiming sets total durations of request round-trips and UAST decoding to zero
+func (r *requester) resetTiming() {
+	r.rpc = 0
+	r.decode = 0
+}
+
+// setTimingMetrics stores durations of request round-trip and UAST decoding per operation as additional metrics
+// of a given benchmark, decoding is not stored if it's skipped
+func (r *requester) setTimingMetrics(b *performance.Benchmark, ops int) {
+	if ops == 0 {
+		return
+	}
+	b.SetMetric(storage.RPCSeconds, (r.rpc / time.Duration(ops)).Seconds())
+	if !r.skipDecode {
+		b.SetMetric(storage.ClientDecodeSeconds, (r.decode / time.Duration(ops)).Seconds())
+	}
+}
+
+// setMetrics stores request counters as additional metrics of a given benchmark
+func (r *requester) setMetrics(b *performance.Benchmark) {
+	b.SetMetric(storage.Timeouts, float64(r.timeouts))
+	b.SetMetric(storage.Retries, float64(r.retries))
+}
+
+// isRetriable reports whether the request failed with error that is worth retrying
+func isRetriable(err error) bool {
+	if errRequestTimeout.Is(err) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package grpc_helper
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/common/expfmt"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var errScrapeFailed = errors.NewKind("cannot scrape metrics from %v: %v")
+
+// gauge suffixes are added to names of gauges stored before and after the benchmark
+const (
+	gaugeBeforeSuffix = "_before"
+	gaugeAfterSuffix  = "_after"
+)
+
+// ServerMetrics contains current values of the server metrics by name
+type ServerMetrics struct {
+	// Cumulative contains metrics that only grow, so their change per operation can be measured
+	Cumulative map[string]float64
+	// Gauges contains metrics that describe the current state of the server, e.g. an amount of driver instances
+	Gauges map[string]float64
+}
+
+// MetricsScraper reads metrics of the benchmarked server
+type MetricsScraper interface {
+	// Scrape returns current values of the server metrics
+	Scrape(ctx context.Context) (ServerMetrics, error)
+}
+
+// PrometheusScraper reads metrics with a given prefix from Prometheus endpoint. Counters are returned by name
+// and histograms and summaries as name_sum and name_count as cumulative metrics, gauges are returned by name.
+// Values of metrics with several label sets are summed up
+type PrometheusScraper struct {
+	// URL is a URL of Prometheus endpoint, e.g. http://localhost:2112/metrics
+	URL string
+	// Prefix is a prefix of names of metrics to be read, empty prefix reads all metrics
+	Prefix string
+}
+
+// Scrape implements MetricsScraper
+func (s PrometheusScraper) Scrape(ctx context.Context) (ServerMetrics, error) {
+	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	if err != nil {
+		return ServerMetrics{}, errScrapeFailed.New(s.URL, err)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return ServerMetrics{}, errScrapeFailed.New(s.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ServerMetrics{}, errScrapeFailed.New(s.URL, resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return ServerMetrics{}, errScrapeFailed.New(s.URL, err)
+	}
+
+	values := make(map[string]float64)
+	gauges := make(map[string]float64)
+	for name, f := range families {
+		if !strings.HasPrefix(name, s.Prefix) {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			switch {
+			case m.Counter != nil:
+				values[name] += m.GetCounter().GetValue()
+			case m.Gauge != nil:
+				gauges[name] += m.GetGauge().GetValue()
+			case m.Histogram != nil:
+				values[name+"_sum"] += m.GetHistogram().GetSampleSum()
+				values[name+"_count"] += float64(m.GetHistogram().GetSampleCount())
+			case m.Summary != nil:
+				values[name+"_sum"] += m.GetSummary().GetSampleSum()
+				values[name+"_count"] += float64(m.GetSummary().GetSampleCount())
+			}
+		}
+	}
+	return ServerMetrics{Cumulative: values, Gauges: gauges}, nil
+}
+
+// metricsMeter measures the change of server metrics between its creation and measure call
+type metricsMeter struct {
+	scraper MetricsScraper
+	start   ServerMetrics
+	err     error
+}
+
+func newMetricsMeter(ctx context.Context, scraper MetricsScraper) *metricsMeter {
+	m := &metricsMeter{scraper: scraper}
+	if scraper != nil {
+		m.start, m.err = scraper.Scrape(ctx)
+	}
+	return m
+}
+
+// measure returns the change of cumulative server metrics since the meter creation divided by a given amount
+// of operations along with the values of gauges at the meter creation and now, that are not normalized
+func (m *metricsMeter) measure(ctx context.Context, ops int) (map[string]float64, error) {
+	if m.scraper == nil || m.err != nil || ops == 0 {
+		return nil, m.err
+	}
+	end, err := m.scraper.Scrape(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]float64, len(end.Cumulative)+2*len(end.Gauges))
+	for name, v := range end.Cumulative {
+		res[name] = (v - m.start.Cumulative[name]) / float64(ops)
+	}
+	for name, v := range end.Gauges {
+		if before, ok := m.start.Gauges[name]; ok {
+			res[name+gaugeBeforeSuffix] = before
+		}
+		res[name+gaugeAfterSuffix] = v
+	}
+	return res, nil
+}
@@ -0,0 +1,252 @@
+package grpc_helper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bblfsh/performance"
+	"github.com/bblfsh/performance/storage"
+
+	"golang.org/x/tools/benchmark/parse"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// soakName is a name of benchmarks produced by the soak test
+const soakName = "soak"
+
+var (
+	errInvalidSoak = errors.NewKind("invalid soak test: %v")
+	errSoakFailed  = errors.NewKind("soak test has failed: %v")
+	errSoakOption  = errors.NewKind("%v is not supported by soak test")
+)
+
+// Soak describes the long-running test that cycles through fixtures and periodically samples
+// memory of the server and latency of requests
+type Soak struct {
+	// Duration is a total duration of the soak test
+	Duration time.Duration
+	// Interval is a period of sampling
+	Interval time.Duration
+	// Settle is a duration since the start, samples of which are not used to detect memory growth and latency drift
+	Settle time.Duration
+	// Concurrency is an amount of concurrent clients
+	Concurrency int
+	// MaxMemorySlope is the maximal allowed memory growth in bytes per hour
+	MaxMemorySlope float64
+	// MaxLatencyDrift is the maximal allowed ratio of median latency at the end of the test to the one at the start
+	MaxLatencyDrift float64
+	// Memory returns the current memory usage of the server in bytes
+	Memory func(ctx context.Context) (uint64, error)
+}
+
+// validate checks if the soak test limits are sane and rejects the options of meta that the soak test does not support
+func (s Soak) validate(meta BenchmarkGRPCMeta) error {
+	switch {
+	case s.Duration <= 0 || s.Interval <= 0:
+		return errInvalidSoak.New("duration and interval should be positive")
+	case s.Interval > s.Duration:
+		return errInvalidSoak.New("interval should not exceed duration")
+	case s.Concurrency < 1:
+		return errInvalidSoak.New("concurrency should be positive")
+	case s.Memory == nil:
+		return errInvalidSoak.New("memory sampler is not set")
+	case len(meta.Modes) > 0:
+		return errSoakOption.New("UAST mode")
+	case len(meta.Compressions) > 0:
+		return errSoakOption.New("compression")
+	}
+	return nil
+}
+
+// soakSample is a single sample of the soak test
+type soakSample struct {
+	at      time.Duration
+	memory  uint64
+	latency performance.LatencyStats
+}
+
+// BenchmarkSoakAndStore performs steps
+// 1) creates client to GRPC server
+// 2) filters files from a given directories
+// 3) warms up the driver using the first file unless warm up is disabled
+// 4) replays requests with the filtered files in turn until the duration passes, sampling memory and latency each interval
+// 5) fits the lines to memory and median latency samples taken after the settle period
+// 6) stores the summary to a given storage and fails if memory grows or latency drifts beyond the thresholds
+func BenchmarkSoakAndStore(ctx context.Context, meta BenchmarkGRPCMeta, soak Soak) error {
+	if err := soak.validate(meta); err != nil {
+		return err
+	}
+	if err := meta.WarmUp.validate(); err != nil {
+		return err
+	}
+
+	client, _, err := dial(ctx, meta.Address, "")
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	fixtures, fingerprint, err := readFixtures(meta)
+	if err != nil {
+		return err
+	}
+
+	if meta.WarmUp.Strategy != WarmUpNone {
+		if err := meta.WarmUp.run(ctx, newRequester(client, nil, meta), fixtures[0]); err != nil {
+			return err
+		}
+	}
+
+	next := cycle(meta.Language, fixtures)
+	var (
+		samples  []soakSample
+		requests int
+		total    time.Duration
+		failed   int
+		timeouts int
+		retries  int
+	)
+	start := time.Now()
+	for time.Since(start) < soak.Duration && ctx.Err() == nil {
+		d := soak.Interval
+		if left := soak.Duration - time.Since(start); left < d {
+			d = left
+		}
+
+		res := replay(ctx, client, meta, soak.Concurrency, d, next)
+		if f := res.failed(); f > 0 {
+			if meta.FailFast {
+				return errWorkloadFailed.New(f)
+			}
+			log.Warningf("%d requests of the soak test have failed", f)
+			failed += f
+		}
+		timeouts += res.timeouts
+		retries += res.retries
+
+		mem, err := soak.Memory(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return err
+		}
+
+		var latencies []time.Duration
+		for _, l := range res.latencies {
+			latencies = append(latencies, l...)
+		}
+		s := soakSample{
+			at:      time.Since(start),
+			memory:  mem,
+			latency: performance.NewLatencyStats(latencies),
+		}
+		samples = append(samples, s)
+		requests += s.latency.Count
+		total += s.latency.Mean * time.Duration(s.latency.Count)
+		log.Infof("soak %v: memory %d bytes, %d requests, p50 %v, p99 %v",
+			s.at.Round(time.Second), s.memory, s.latency.Count, s.latency.P50, s.latency.P99)
+	}
+	elapsed := time.Since(start)
+	// the loop stops before the duration passes only if it was interrupted
+	partial := elapsed < soak.Duration
+
+	bench := performance.NewBenchmark(&parse.Benchmark{
+		Name:     soakName,
+		N:        requests,
+		Measured: parse.NsPerOp,
+	})
+	if requests > 0 {
+		bench.Benchmark.NsPerOp = float64(total / time.Duration(requests))
+	}
+	bench.SetMetric(storage.RequestsPerSecond, float64(requests)/elapsed.Seconds())
+	bench.SetMetric(storage.FailedRequests, float64(failed))
+	bench.SetMetric(storage.Timeouts, float64(timeouts))
+	bench.SetMetric(storage.Retries, float64(retries))
+
+	var peak uint64
+	for _, s := range samples {
+		if s.memory > peak {
+			peak = s.memory
+		}
+	}
+	bench.SetMetric(storage.PeakMemoryBytes, float64(peak))
+
+	var violations []string
+	settled := settledSamples(samples, soak.Settle)
+	if len(settled) < 2 {
+		log.Warningf("not enough samples after the settle period to detect memory growth and latency drift")
+	} else {
+		slope, drift := trends(settled)
+		log.Infof("memory slope: %.0f bytes per hour, latency drift: %.2f", slope, drift)
+		bench.SetMetric(storage.MemorySlope, slope)
+		bench.SetMetric(storage.LatencyDrift, drift)
+
+		if slope > soak.MaxMemorySlope {
+			violations = append(violations, fmt.Sprintf("memory grows by %.0f bytes per hour, limit is %.0f", slope, soak.MaxMemorySlope))
+		}
+		if drift > soak.MaxLatencyDrift {
+			violations = append(violations, fmt.Sprintf("latency has drifted by %.2f times, limit is %.2f", drift, soak.MaxLatencyDrift))
+		}
+	}
+
+	// store data
+	storageClient, err := storage.NewClient(meta.Storage)
+	if err != nil {
+		return err
+	}
+	defer storageClient.Close()
+
+	if err := storageClient.Dump(performance.PartialTags(partial, performance.MergeTags(map[string]string{
+		"language": meta.Language,
+		"commit":   meta.Commit,
+		"level":    meta.Level,
+
+		performance.CorpusHashTag: fingerprint.Corpus,
+	}, meta.runTags())), storage.WithHostMetrics([]performance.Benchmark{bench})...); err != nil {
+		return err
+	}
+	if err := meta.saveFingerprint(partial, fingerprint); err != nil {
+		return err
+	}
+
+	if len(violations) > 0 {
+		return errSoakFailed.New(strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// settledSamples returns samples taken after the settle period
+func settledSamples(samples []soakSample, settle time.Duration) []soakSample {
+	for i, s := range samples {
+		if s.at > settle {
+			return samples[i:]
+		}
+	}
+	return nil
+}
+
+// trends returns memory growth in bytes per hour and the ratio of median latency predicted
+// for the last sample to the one predicted for the first sample
+func trends(samples []soakSample) (slope, drift float64) {
+	hours := make([]float64, len(samples))
+	memory := make([]float64, len(samples))
+	latency := make([]float64, len(samples))
+	for i, s := range samples {
+		hours[i] = s.at.Hours()
+		memory[i] = float64(s.memory)
+		latency[i] = s.latency.P50.Seconds()
+	}
+
+	slope, _ = performance.LinearRegression(hours, memory)
+
+	ls, li := performance.LinearRegression(hours, latency)
+	first, last := ls*hours[0]+li, ls*hours[len(hours)-1]+li
+	if first > 0 {
+		drift = last / first
+	}
+	return slope, drift
+}
@@ -0,0 +1,201 @@
+package grpc_helper
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/bblfsh/performance"
+	"github.com/bblfsh/performance/storage"
+
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+const (
+	// concurrencyTag is a benchmark specific storage label that contains an amount of concurrent clients
+	concurrencyTag = "concurrency"
+
+	sweepName      = "concurrency_sweep"
+	saturationName = "concurrency_saturation"
+)
+
+var (
+	errInvalidSweep = errors.NewKind("invalid concurrency sweep: %v")
+	errSweepOption  = errors.NewKind("%v is not supported by concurrency sweep")
+)
+
+// Sweep describes the series of concurrent benchmarks with concurrency 1, 2, 4, ... up to MaxConcurrency.
+// All concurrent clients share a single gRPC connection, so concurrency is the amount of concurrent streams
+type Sweep struct {
+	// MaxConcurrency is the upper limit of concurrent clients, it is always the last step
+	MaxConcurrency int
+	// StepDuration is a duration of each step of the sweep
+	StepDuration time.Duration
+	// ScalingThreshold is the minimal ratio of throughput of a step to the throughput of the previous step,
+	// that is considered as scaling when concurrency is doubled, for other steps the expected gain is proportional
+	// to the increase of concurrency
+	ScalingThreshold float64
+	// LatencyThreshold is the maximal ratio of p99 latency of a step to p99 latency with a single client
+	LatencyThreshold float64
+}
+
+// validate checks if the sweep limits are sane
+func (s Sweep) validate() error {
+	switch {
+	case s.MaxConcurrency < 1:
+		return errInvalidSweep.New("max concurrency should be positive")
+	case s.StepDuration <= 0:
+		return errInvalidSweep.New("step duration should be positive")
+	case s.ScalingThreshold <= 0 || s.LatencyThreshold <= 0:
+		return errInvalidSweep.New("thresholds should be positive")
+	}
+	return nil
+}
+
+// steps returns concurrency of each step: powers of two below the limit followed by the limit itself
+func (s Sweep) steps() []int {
+	var steps []int
+	for c := 1; c < s.MaxConcurrency; c *= 2 {
+		steps = append(steps, c)
+	}
+	return append(steps, s.MaxConcurrency)
+}
+
+// checkOptions rejects the options of meta that the sweep does not support
+func (s Sweep) checkOptions(meta BenchmarkGRPCMeta) error {
+	switch {
+	case len(meta.Modes) > 0:
+		return errSweepOption.New("UAST mode")
+	case len(meta.Compressions) > 0:
+		return errSweepOption.New("compression")
+	case meta.DetectLanguage:
+		return errSweepOption.New("language detection")
+	}
+	return nil
+}
+
+// BenchmarkSweepAndStore performs steps
+// 1) creates client to GRPC server
+// 2) filters files from a given directories
+// 3) warms up the driver using the first file unless warm up is disabled
+// 4) for concurrency 1, 2, 4, ... and the limit replays requests with the filtered files in turn over one connection
+// 5) detects the saturation point: the last step before throughput stops scaling or p99 latency exceeds the threshold
+// 6) stores the results of each step tagged by concurrency along with the saturation point to a given storage
+func BenchmarkSweepAndStore(ctx context.Context, meta BenchmarkGRPCMeta, sweep Sweep) error {
+	if err := sweep.validate(); err != nil {
+		return err
+	}
+	if err := sweep.checkOptions(meta); err != nil {
+		return err
+	}
+	if err := meta.WarmUp.validate(); err != nil {
+		return err
+	}
+
+	client, _, err := dial(ctx, meta.Address, "")
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	fixtures, fingerprint, err := readFixtures(meta)
+	if err != nil {
+		return err
+	}
+
+	if meta.WarmUp.Strategy != WarmUpNone {
+		if err := meta.WarmUp.run(ctx, newRequester(client, nil, meta), fixtures[0]); err != nil {
+			return err
+		}
+	}
+
+	next := cycle(meta.Language, fixtures)
+	var (
+		benchmarks []performance.Benchmark
+		knee       = -1
+	)
+	steps := sweep.steps()
+	for _, c := range steps {
+		if ctx.Err() != nil {
+			break
+		}
+		log.Debugf("replaying requests for %v using %d clients", sweep.StepDuration, c)
+		res := replay(ctx, client, meta, c, sweep.StepDuration, next)
+		if res.interrupted(sweep.StepDuration) {
+			log.Warningf("step with concurrency %d was interrupted, skipping", c)
+			break
+		}
+		if failed := res.failed(); failed > 0 {
+			if meta.FailFast {
+				return errWorkloadFailed.New(failed)
+			}
+			log.Warningf("%d requests with concurrency %d have failed", failed, c)
+		}
+
+		bench := res.aggregate(sweepName)
+		bench.SetTag(concurrencyTag, strconv.Itoa(c))
+		benchmarks = append(benchmarks, bench)
+
+		if knee < 0 && len(benchmarks) > 1 && saturated(sweep, steps, benchmarks) {
+			knee = len(benchmarks) - 2
+			log.Infof("saturation detected at concurrency %d", steps[knee])
+		}
+	}
+	// the run is partial if it has stopped before the last step
+	partial := len(benchmarks) < len(steps)
+	if knee < 0 && len(benchmarks) > 0 {
+		log.Infof("throughput scales up to the concurrency limit %d", sweep.MaxConcurrency)
+		knee = len(benchmarks) - 1
+	}
+
+	if knee >= 0 {
+		saturation := performance.NewBenchmark(&benchmarks[knee].Benchmark)
+		saturation.Benchmark.Name = saturationName
+		for k, v := range benchmarks[knee].Metrics {
+			saturation.SetMetric(k, v)
+		}
+		saturation.SetMetric(storage.SaturationConcurrency, float64(steps[knee]))
+		benchmarks = append(benchmarks, saturation)
+	}
+
+	// store data
+	storageClient, err := storage.NewClient(meta.Storage)
+	if err != nil {
+		return err
+	}
+	defer storageClient.Close()
+
+	if err := storageClient.Dump(performance.PartialTags(partial, performance.MergeTags(map[string]string{
+		"language": meta.Language,
+		"commit":   meta.Commit,
+		"level":    meta.Level,
+
+		performance.CorpusHashTag: fingerprint.Corpus,
+	}, meta.runTags())), storage.WithHostMetrics(benchmarks)...); err != nil {
+		return err
+	}
+	return meta.saveFingerprint(partial, fingerprint)
+}
+
+// saturated reports whether the last step of the sweep has stopped scaling compared to the previous one
+// or its p99 latency has exceeded the threshold compared to the first step with successful requests.
+// Expected gain of throughput is scaled by the increase of concurrency, so the last step clamped to the limit
+// is not required to gain as much as the doubled ones
+func saturated(sweep Sweep, concurrency []int, steps []performance.Benchmark) bool {
+	n := len(steps)
+	prev, last := steps[n-2], steps[n-1]
+	increase := float64(concurrency[n-1])/float64(concurrency[n-2]) - 1
+	expected := 1 + (sweep.ScalingThreshold-1)*increase
+	if last.Metrics[storage.RequestsPerSecond] < prev.Metrics[storage.RequestsPerSecond]*expected {
+		return true
+	}
+
+	// steps where every request has failed have no latency
+	for _, s := range steps[:n-1] {
+		if base := s.Metrics[storage.P99Seconds]; base > 0 {
+			return last.Metrics[storage.P99Seconds] > base*sweep.LatencyThreshold
+		}
+	}
+	return false
+}
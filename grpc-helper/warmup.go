@@ -0,0 +1,81 @@
+package grpc_helper
+
+import (
+	"context"
+	"time"
+
+	"github.com/bblfsh/performance"
+
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+const (
+	// WarmUpFirst warms up the driver using the first file only, before the benchmarks
+	WarmUpFirst = "first"
+	// WarmUpAll warms up the driver using every file right before its benchmark
+	WarmUpAll = "all"
+	// WarmUpNone disables the warm up
+	WarmUpNone = "none"
+)
+
+var (
+	errInvalidWarmUp = errors.NewKind("invalid warm up strategy %v, supported: " +
+		WarmUpFirst + ", " + WarmUpAll + ", " + WarmUpNone)
+	errInvalidWarmUpLimits = errors.NewKind("invalid warm up limits: %v")
+)
+
+// WarmUp defines how the driver is warmed up before the benchmarks
+type WarmUp struct {
+	// Strategy defines which files are used for the warm up(first, all, none)
+	Strategy string
+	// Iterations is the minimal amount of warm up requests per file
+	Iterations int
+	// Duration is the minimal duration of warm up per file, requests are repeated until it passes
+	Duration time.Duration
+}
+
+// validate checks if the warm up strategy is supported and its limits are not negative
+func (w WarmUp) validate() error {
+	switch w.Strategy {
+	case WarmUpFirst, WarmUpAll, WarmUpNone:
+	default:
+		return errInvalidWarmUp.New(w.Strategy)
+	}
+	switch {
+	case w.Iterations < 0:
+		return errInvalidWarmUpLimits.New("iterations should not be negative")
+	case w.Duration < 0:
+		return errInvalidWarmUpLimits.New("duration should not be negative")
+	}
+	return nil
+}
+
+// required reports whether the i-th benchmarked file should be used for the warm up
+func (w WarmUp) required(i int) bool {
+	switch w.Strategy {
+	case WarmUpFirst:
+		return i == 0
+	case WarmUpAll:
+		return true
+	}
+	return false
+}
+
+// run sends warm up requests with a given fixture until both iterations and duration limits are reached
+func (w WarmUp) run(ctx context.Context, req *requester, fixture *performance.Fixture) error {
+	log.Debugf("🔥warming up the language %s using file %s", req.language, fixture.Path)
+	defer performance.Trace(performance.TraceCategoryPhase, "warm up", map[string]string{"file": fixture.Path})()
+
+	start := time.Now()
+	var n int
+	for n < w.Iterations || time.Since(start) < w.Duration {
+		if _, err := req.parse(ctx, fixture); err != nil {
+			return errWarmUpFailed.New(fixture.Path, err)
+		}
+		n++
+	}
+
+	log.Debugf("warm up done for file %s in %v, %d requests", fixture.Path, time.Since(start), n)
+	return nil
+}
@@ -0,0 +1,247 @@
+package grpc_helper
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bblfsh/performance"
+	"github.com/bblfsh/performance/storage"
+
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// workloadName is a name of benchmarks produced by the mixed workload
+const workloadName = "mixed_workload"
+
+var (
+	errNoLanguagesDetected = errors.NewKind("no languages detected, check directories and weights")
+	errWorkloadFailed      = errors.NewKind("%d requests of the workload have failed")
+	errInvalidWorkload     = errors.NewKind("invalid workload: %v")
+	errWorkloadOption      = errors.NewKind("%v is not supported by mixed workload")
+)
+
+// Workload describes a weighted mix of requests of several languages replayed through one server
+type Workload struct {
+	// LanguageDirs maps languages to directories with their fixtures. If empty, fixtures are taken from
+	// the Dirs of BenchmarkGRPCMeta and their languages are detected by file extensions
+	LanguageDirs map[string]string
+	// Weights maps languages to their relative share of requests, languages without weight get 1,
+	// languages with zero weight are excluded
+	Weights map[string]int
+	// Concurrency is an amount of concurrent clients
+	Concurrency int
+	// Duration is a duration of the replay
+	Duration time.Duration
+}
+
+// BenchmarkWorkloadAndStore performs steps
+// 1) creates client to GRPC server
+// 2) filters files from a given directories and groups them by language
+// 3) warms up each language using its first file unless warm up is disabled
+// 4) replays the weighted mix of requests for the workload duration using concurrent clients
+// 5) stores per-language and aggregated results to a given storage along with the fingerprint of replayed files
+func BenchmarkWorkloadAndStore(ctx context.Context, meta BenchmarkGRPCMeta, workload Workload) error {
+	if err := workload.validate(meta); err != nil {
+		return err
+	}
+	if err := meta.WarmUp.validate(); err != nil {
+		return err
+	}
+
+	client, _, err := dial(ctx, meta.Address, "")
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	fixtures, err := workload.fixtures(meta)
+	if err != nil {
+		return err
+	}
+	m := newMix(fixtures, workload.Weights)
+	if len(m.languages) == 0 {
+		return errNoLanguagesDetected.New()
+	}
+	log.Debugf("workload languages: %v, weights: %v", m.languages, m.weights)
+
+	fingerprint, err := m.fingerprint()
+	if err != nil {
+		return err
+	}
+	if err := performance.CheckFingerprint(meta.FingerprintFile, fingerprint); err != nil {
+		return err
+	}
+
+	if meta.WarmUp.Strategy != WarmUpNone {
+		for _, l := range m.languages {
+			lm := meta
+			lm.Language = l
+			if err := meta.WarmUp.run(ctx, newRequester(client, nil, lm), fixtures[l][0]); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Debugf("replaying the workload for %v using %d clients", workload.Duration, workload.Concurrency)
+	res := replay(ctx, client, meta, workload.Concurrency, workload.Duration, m.next)
+	if failed := res.failed(); failed > 0 {
+		if meta.FailFast {
+			return errWorkloadFailed.New(failed)
+		}
+		log.Warningf("%d requests of the workload have failed", failed)
+	}
+
+	// store data
+	storageClient, err := storage.NewClient(meta.Storage)
+	if err != nil {
+		return err
+	}
+	defer storageClient.Close()
+
+	if err := storageClient.Dump(performance.PartialTags(res.interrupted(workload.Duration), performance.MergeTags(map[string]string{
+		"language": meta.Language,
+		"commit":   meta.Commit,
+		"level":    meta.Level,
+
+		performance.CorpusHashTag: fingerprint.Corpus,
+	}, meta.runTags())), storage.WithHostMetrics(res.benchmarks(workloadName))...); err != nil {
+		return err
+	}
+	return meta.saveFingerprint(res.interrupted(workload.Duration), fingerprint)
+}
+
+// validate checks the workload parameters and rejects the options of meta that the workload does not support
+func (w Workload) validate(meta BenchmarkGRPCMeta) error {
+	switch {
+	case w.Concurrency <= 0:
+		return errInvalidWorkload.New("concurrency should be positive")
+	case w.Duration <= 0:
+		return errInvalidWorkload.New("duration should be positive")
+	case len(meta.Modes) > 0:
+		return errWorkloadOption.New("UAST mode")
+	case len(meta.Compressions) > 0:
+		return errWorkloadOption.New("compression")
+	case meta.DetectLanguage:
+		return errWorkloadOption.New("language detection")
+	}
+	return nil
+}
+
+// fixtures reads the files of the workload and groups them by language
+func (w Workload) fixtures(meta BenchmarkGRPCMeta) (map[string][]*performance.Fixture, error) {
+	files := make(map[string][]string)
+	if len(w.LanguageDirs) > 0 {
+		for l, d := range w.LanguageDirs {
+			f, err := performance.GetFiles(meta.FilterPrefix, meta.ExcludeSubstrings, d)
+			if err != nil {
+				return nil, errGetFiles.Wrap(err)
+			}
+			files[l] = append(files[l], f...)
+		}
+	} else {
+		all, err := performance.GetFiles(meta.FilterPrefix, meta.ExcludeSubstrings, meta.Dirs...)
+		if err != nil {
+			return nil, errGetFiles.Wrap(err)
+		}
+		for _, f := range all {
+			l, ok := performance.LanguageByExtension(f)
+			if !ok {
+				log.Debugf("cannot detect language of the file %s, skipping", f)
+				continue
+			}
+			files[l] = append(files[l], f)
+		}
+	}
+
+	fixtures := make(map[string][]*performance.Fixture)
+	for l, fs := range files {
+		for _, f := range fs {
+			fixture, err := performance.ReadFixture(f)
+			if err != nil {
+				return nil, errGetFiles.Wrap(err)
+			}
+			fixtures[l] = append(fixtures[l], fixture)
+		}
+	}
+	return fixtures, nil
+}
+
+// mix produces requests of several languages according to their weights,
+// fixtures of each language are taken in turn. It's safe for concurrent use
+type mix struct {
+	mu         sync.Mutex
+	rnd        *rand.Rand
+	languages  []string
+	weights    []int
+	cumulative []int
+	fixtures   map[string][]*performance.Fixture
+	positions  map[string]int
+}
+
+func newMix(fixtures map[string][]*performance.Fixture, weights map[string]int) *mix {
+	m := &mix{
+		// fixed seed makes the sequence of requests reproducible between runs
+		rnd:       rand.New(rand.NewSource(1)),
+		fixtures:  fixtures,
+		positions: make(map[string]int),
+	}
+
+	var languages []string
+	for l, f := range fixtures {
+		if len(f) > 0 {
+			languages = append(languages, l)
+		}
+	}
+	sort.Strings(languages)
+
+	var total int
+	for _, l := range languages {
+		w, ok := weights[l]
+		if !ok {
+			w = 1
+		}
+		if w <= 0 {
+			continue
+		}
+		total += w
+		m.languages = append(m.languages, l)
+		m.weights = append(m.weights, w)
+		m.cumulative = append(m.cumulative, total)
+	}
+	return m
+}
+
+// fingerprint returns the fingerprint of the fixtures of the languages included in the mix,
+// so the results can be tied to the corpus
+func (m *mix) fingerprint() (*performance.Fingerprint, error) {
+	var files []string
+	for _, l := range m.languages {
+		for _, f := range m.fixtures[l] {
+			files = append(files, f.Path)
+		}
+	}
+	fp, err := performance.NewFingerprint(files)
+	if err != nil {
+		return nil, errGetFiles.Wrap(err)
+	}
+	return fp, nil
+}
+
+func (m *mix) next() request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.rnd.Intn(m.cumulative[len(m.cumulative)-1])
+	i := sort.SearchInts(m.cumulative, n+1)
+	l := m.languages[i]
+
+	fixtures := m.fixtures[l]
+	f := fixtures[m.positions[l]%len(fixtures)]
+	m.positions[l]++
+
+	return request{language: l, fixture: f}
+}
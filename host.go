@@ -0,0 +1,197 @@
+package performance
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+const (
+	// HostGovernorTag is a storage label that contains CPU frequency scaling governors of the host
+	HostGovernorTag = "host_cpu_governor"
+	// HostQuietTag is a storage label that shows if the host passed the stability check
+	HostQuietTag = "host_quiet"
+
+	// SkipHostCheckAnnotation is an annotation of commands that do not run benchmarks, so the host is not checked
+	SkipHostCheckAnnotation = "skip-host-check"
+
+	performanceGovernor = "performance"
+	swapSampleDuration  = time.Second
+)
+
+var errHostNotQuiet = errors.NewKind("host is not quiet enough for benchmarks: %v")
+
+var (
+	// hostTags contains the result of the last host check, they are added to the environment
+	hostTags map[string]string
+	// hostCheck contains observed values of the last host check, nil if the host was not checked
+	hostCheck *HostCheck
+)
+
+// HostCheck contains the values observed by the host stability check
+type HostCheck struct {
+	// LoadPerCore is 1-minute load average divided by an amount of CPU cores
+	LoadPerCore float64
+	// Governors is a list of distinct CPU frequency scaling governors, empty if frequency scaling is not available
+	Governors []string
+	// SwapPagesPerSecond is an amount of pages swapped in and out per second
+	SwapPagesPerSecond float64
+	// RunningContainers is an amount of running containers, -1 if it cannot be obtained
+	RunningContainers int
+}
+
+// LastHostCheck returns observed values of the last host check, so they can be stored as metrics,
+// false is returned if the host was not checked
+func LastHostCheck() (HostCheck, bool) {
+	if hostCheck == nil {
+		return HostCheck{}, false
+	}
+	return *hostCheck, true
+}
+
+// CheckHost observes load average, CPU frequency scaling governors, swap activity and running containers using
+// a given function, values are compared to thresholds and returned along with the list of problems found.
+// Observed values are stored, so they can be added to benchmark metrics, the result of the check and the governors
+// are added to the environment tags
+func CheckHost(maxLoadPerCore float64, containers func() (int, error)) (HostCheck, []string) {
+	var (
+		check    HostCheck
+		problems []string
+	)
+
+	if load, err := loadAverage(); err != nil {
+		log.Warningf("cannot get load average: %v", err)
+	} else {
+		check.LoadPerCore = load / float64(runtime.NumCPU())
+		if check.LoadPerCore > maxLoadPerCore {
+			problems = append(problems, fmt.Sprintf("load average per core is %.2f, threshold is %.2f", check.LoadPerCore, maxLoadPerCore))
+		}
+	}
+
+	check.Governors = governors()
+	for _, g := range check.Governors {
+		if g != performanceGovernor {
+			problems = append(problems, fmt.Sprintf("CPU frequency scaling governor is %q instead of %q", g, performanceGovernor))
+		}
+	}
+
+	if swap, err := swapRate(); err != nil {
+		log.Warningf("cannot get swap activity: %v", err)
+	} else {
+		check.SwapPagesPerSecond = swap
+		if swap > 0 {
+			problems = append(problems, fmt.Sprintf("host is swapping %.0f pages per second", swap))
+		}
+	}
+
+	check.RunningContainers = -1
+	if n, err := containers(); err != nil {
+		log.Warningf("cannot get running containers: %v", err)
+	} else {
+		check.RunningContainers = n
+		if n > 0 {
+			problems = append(problems, fmt.Sprintf("%d other containers are running", n))
+		}
+	}
+
+	hostTags = check.tags(len(problems) == 0)
+	hostCheck = &check
+	return check, problems
+}
+
+// ReportHostCheck logs given problems of the host check, if strict is set problems are returned as an error
+func ReportHostCheck(problems []string, strict bool) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	if strict {
+		return errHostNotQuiet.New(strings.Join(problems, "; "))
+	}
+	for _, p := range problems {
+		log.Warningf("host is not quiet: %s", p)
+	}
+	return nil
+}
+
+func (c HostCheck) tags(quiet bool) map[string]string {
+	tags := map[string]string{HostQuietTag: strconv.FormatBool(quiet)}
+	if len(c.Governors) > 0 {
+		tags[HostGovernorTag] = strings.Join(c.Governors, ",")
+	}
+	return tags
+}
+
+// loadAverage returns 1-minute load average of the host
+func loadAverage() (float64, error) {
+	data, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected format of /proc/loadavg: %q", data)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// governors returns sorted distinct CPU frequency scaling governors of all cores
+func governors() []string {
+	paths, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/cpufreq/scaling_governor")
+	set := make(map[string]string)
+	for _, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		set[strings.TrimSpace(string(data))] = ""
+	}
+	res, _ := SplitStringMap(set)
+	return res
+}
+
+// swapRate samples swapped in and out pages during a short period and returns their rate per second
+func swapRate() (float64, error) {
+	before, err := swappedPages()
+	if err != nil {
+		return 0, err
+	}
+	time.Sleep(swapSampleDuration)
+	after, err := swappedPages()
+	if err != nil {
+		return 0, err
+	}
+	return float64(after-before) / swapSampleDuration.Seconds(), nil
+}
+
+// swappedPages returns total amount of pages swapped in and out since the boot
+func swappedPages() (uint64, error) {
+	f, err := os.Open("/proc/vmstat")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var total uint64
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 || (fields[0] != "pswpin" && fields[0] != "pswpout") {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, s.Err()
+}
@@ -0,0 +1,34 @@
+package performance
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// extensions maps file extensions to the languages supported by drivers
+var extensions = map[string]string{
+	".sh":   "bash",
+	".bash": "bash",
+	".c":    "cpp",
+	".cc":   "cpp",
+	".cpp":  "cpp",
+	".cxx":  "cpp",
+	".h":    "cpp",
+	".hpp":  "cpp",
+	".cs":   "csharp",
+	".go":   "go",
+	".java": "java",
+	".js":   "javascript",
+	".jsx":  "javascript",
+	".php":  "php",
+	".py":   "python",
+	".rb":   "ruby",
+	".ts":   "typescript",
+	".tsx":  "typescript",
+}
+
+// LanguageByExtension returns the language of a given file detected by its extension
+func LanguageByExtension(path string) (string, bool) {
+	lang, ok := extensions[strings.ToLower(filepath.Ext(path))]
+	return lang, ok
+}
@@ -0,0 +1,145 @@
+package performance
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+const (
+	// ProfileCPU is a kind of CPU profile
+	ProfileCPU = "cpu"
+	// ProfileHeap is a kind of profile of live heap objects
+	ProfileHeap = "heap"
+	// ProfileAllocs is a kind of profile of all past allocations
+	ProfileAllocs = "allocs"
+	// ProfileMutex is a kind of profile of mutex contention
+	ProfileMutex = "mutex"
+
+	// ProfileTag is a storage label that lists kinds of profiles captured during the run, profiling slows benchmarks down
+	ProfileTag = "profile"
+)
+
+var (
+	errUnknownProfile = errors.NewKind("unknown profile %v, supported: " +
+		ProfileCPU + ", " + ProfileHeap + ", " + ProfileAllocs + ", " + ProfileMutex)
+	errProfileFailed = errors.NewKind("cannot write %v profile: %v")
+)
+
+// ValidateProfiles checks if given profile kinds are supported
+func ValidateProfiles(kinds []string) error {
+	for _, k := range kinds {
+		switch k {
+		case ProfileCPU, ProfileHeap, ProfileAllocs, ProfileMutex:
+		default:
+			return errUnknownProfile.New(k)
+		}
+	}
+	return nil
+}
+
+// hasProfile reports whether given kinds of profiles contain a given kind
+func hasProfile(kinds []string, kind string) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ProfileTags returns the tag that marks runs with given kinds of profiles, no tags are returned if profiling is disabled
+func ProfileTags(kinds []string) map[string]string {
+	if len(kinds) == 0 {
+		return nil
+	}
+	return map[string]string{ProfileTag: strings.Join(kinds, ",")}
+}
+
+// ProfilePath returns the path of the profile of a given kind for the benchmark of a given name
+func ProfilePath(dir, name, kind string) string {
+	return filepath.Join(dir, name+"_"+kind+".pprof")
+}
+
+// Profiler writes pprof profiles of the current process per benchmark to a directory.
+// CPU profile covers a single benchmark, the rest of profiles are cumulative since the process start,
+// so the profile of the previous benchmark can be used as a base to get the difference
+type Profiler struct {
+	dir   string
+	kinds []string
+	cpu   *os.File
+}
+
+// NewProfiler creates the directory for profiles of given kinds and enables mutex profiling if needed
+func NewProfiler(dir string, kinds []string) (*Profiler, error) {
+	if err := ValidateProfiles(kinds); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if hasProfile(kinds, ProfileMutex) {
+		runtime.SetMutexProfileFraction(1)
+	}
+	return &Profiler{dir: dir, kinds: kinds}, nil
+}
+
+// Start starts CPU profiling of the benchmark of a given name
+func (p *Profiler) Start(name string) error {
+	if !hasProfile(p.kinds, ProfileCPU) {
+		return nil
+	}
+	f, err := os.Create(ProfilePath(p.dir, name, ProfileCPU))
+	if err != nil {
+		return errProfileFailed.New(ProfileCPU, err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return errProfileFailed.New(ProfileCPU, err)
+	}
+	p.cpu = f
+	return nil
+}
+
+// Stop stops CPU profiling and writes the rest of profiles of the benchmark of a given name
+func (p *Profiler) Stop(name string) error {
+	if p.cpu != nil {
+		pprof.StopCPUProfile()
+		err := p.cpu.Close()
+		p.cpu = nil
+		if err != nil {
+			return errProfileFailed.New(ProfileCPU, err)
+		}
+	}
+
+	for _, k := range p.kinds {
+		if k == ProfileCPU {
+			continue
+		}
+		if k == ProfileHeap {
+			// heap profile shows the state as of the last GC
+			runtime.GC()
+		}
+		if err := p.write(name, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Profiler) write(name, kind string) error {
+	f, err := os.Create(ProfilePath(p.dir, name, kind))
+	if err != nil {
+		return errProfileFailed.New(kind, err)
+	}
+	defer f.Close()
+
+	if err := pprof.Lookup(kind).WriteTo(f, 0); err != nil {
+		return errProfileFailed.New(kind, err)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package performance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-log.v1"
+)
+
+const (
+	// ProgressPrefix is a prefix of output lines that contain progress events, such lines are relayed by ProgressRelay
+	ProgressPrefix = "@progress "
+
+	progressBarWidth = 30
+	progressInterval = 30 * time.Second
+)
+
+// ProgressEvent describes the progress of benchmarks over fixtures
+type ProgressEvent struct {
+	// Done is an amount of completed benchmarks
+	Done int
+	// Total is a total amount of benchmarks
+	Total int
+	// Current is a name of the fixture being benchmarked
+	Current string
+}
+
+// WriteProgressEvent writes a given event to w as a single line, so it can be relayed by ProgressRelay
+func WriteProgressEvent(w io.Writer, e ProgressEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", ProgressPrefix, data)
+	return err
+}
+
+// Progress reports the progress of benchmarks: done and total amounts, the current fixture,
+// elapsed time and estimated time remaining. It draws a progress bar if stderr is a terminal
+// and writes periodic log lines otherwise. It's safe for concurrent use
+type Progress struct {
+	mu      sync.Mutex
+	out     io.Writer
+	tty     bool
+	start   time.Time
+	logged  time.Time
+	event   ProgressEvent
+	drawn   bool
+	stopped bool
+}
+
+// NewProgress returns the progress of a given total amount of benchmarks
+func NewProgress(total int) *Progress {
+	now := time.Now()
+	return &Progress{
+		out:    os.Stderr,
+		tty:    isTerminal(os.Stderr),
+		start:  now,
+		logged: now,
+		event:  ProgressEvent{Total: total},
+	}
+}
+
+// Start marks the benchmark over a given fixture as the current one
+func (p *Progress) Start(fixture string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.event.Current = fixture
+	p.report(false)
+}
+
+// Done marks the current benchmark as completed
+func (p *Progress) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.event.Done++
+	p.report(false)
+}
+
+// Update replaces the progress with a given event, it's used to relay the progress of another process
+func (p *Progress) Update(e ProgressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.event = e
+	p.report(false)
+}
+
+// Write implements io.Writer, it passes output of benchmarks to stderr clearing the progress bar first,
+// so the output does not mix with it, and redraws the bar after the output
+func (p *Progress) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty && p.drawn {
+		fmt.Fprint(p.out, "\r\x1b[K")
+		p.drawn = false
+	}
+	n, err := p.out.Write(data)
+	if p.tty && err == nil {
+		p.report(true)
+	}
+	return n, err
+}
+
+// Finish reports the final progress, Progress should not be used after that
+func (p *Progress) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return
+	}
+	p.event.Current = ""
+	p.report(true)
+	if p.tty && p.drawn {
+		fmt.Fprintln(p.out)
+	}
+	p.stopped = true
+}
+
+// report draws the progress bar or logs the progress line if the interval has passed since the last one
+func (p *Progress) report(force bool) {
+	if p.stopped {
+		return
+	}
+
+	elapsed := time.Since(p.start)
+	eta := "unknown"
+	if p.event.Done > 0 && p.event.Total >= p.event.Done {
+		left := elapsed / time.Duration(p.event.Done) * time.Duration(p.event.Total-p.event.Done)
+		eta = left.Round(time.Second).String()
+	}
+
+	if !p.tty {
+		if !force && time.Since(p.logged) < progressInterval {
+			return
+		}
+		p.logged = time.Now()
+		log.Infof("progress: %d/%d, current: %q, elapsed: %v, eta: %v",
+			p.event.Done, p.event.Total, p.event.Current, elapsed.Round(time.Second), eta)
+		return
+	}
+
+	var ratio float64
+	if p.event.Total > 0 {
+		ratio = float64(p.event.Done) / float64(p.event.Total)
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	filled := int(ratio * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+
+	// \r returns to the beginning of the line and \x1b[K clears the rest of it
+	fmt.Fprintf(p.out, "\r[%s] %d/%d %3.0f%% %s elapsed: %v eta: %v\x1b[K",
+		bar, p.event.Done, p.event.Total, ratio*100, p.event.Current, elapsed.Round(time.Second), eta)
+	p.drawn = true
+}
+
+// isTerminal reports whether a given file is a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// ProgressRelay is a writer that passes progress events from the output of another process to a given function,
+// the rest of the output is passed to the underlying writer
+type ProgressRelay struct {
+	update func(ProgressEvent)
+	out    io.Writer
+	buf    bytes.Buffer
+}
+
+// NewProgressRelay returns the writer that relays progress events to update and the rest of output to out
+func NewProgressRelay(out io.Writer, update func(ProgressEvent)) *ProgressRelay {
+	return &ProgressRelay{update: update, out: out}
+}
+
+// Write implements io.Writer, the last line is kept until it's completed by a newline or Flush is called
+func (r *ProgressRelay) Write(data []byte) (int, error) {
+	r.buf.Write(data)
+	for {
+		i := bytes.IndexByte(r.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(data), nil
+		}
+		line := r.buf.Next(i + 1)
+		if err := r.relay(line); err != nil {
+			return len(data), err
+		}
+	}
+}
+
+// Flush relays the incomplete line left in the buffer, it should be called once the output has ended
+func (r *ProgressRelay) Flush() error {
+	if r.buf.Len() == 0 {
+		return nil
+	}
+	line := append(r.buf.Next(r.buf.Len()), '\n')
+	return r.relay(line)
+}
+
+func (r *ProgressRelay) relay(line []byte) error {
+	// output of processes with terminal has \r\n line endings
+	text := strings.TrimRight(string(line), "\r\n")
+	if i := strings.Index(text, ProgressPrefix); i >= 0 {
+		var e ProgressEvent
+		if err := json.Unmarshal([]byte(text[i+len(ProgressPrefix):]), &e); err == nil {
+			r.update(e)
+			return nil
+		}
+	}
+	_, err := r.out.Write(line)
+	return err
+}
@@ -0,0 +1,38 @@
+package performance
+
+import (
+	"context"
+	"time"
+)
+
+// ResourceStats describes resource usage of the benchmarked container over a period of time
+type ResourceStats struct {
+	// Samples is an amount of samples taken during the period, other fields are meaningless if it's zero
+	Samples int
+	// CPUPercent is an average CPU usage of the container, 100% stands for a single fully used core
+	CPUPercent float64
+	// PeakRSS is the maximal sampled resident memory of the container processes in bytes
+	PeakRSS uint64
+	// PageFaults is an amount of page faults during the period
+	PageFaults uint64
+	// MajorPageFaults is an amount of major page faults during the period
+	MajorPageFaults uint64
+	// NetworkRxBytes is an amount of bytes received by the container during the period
+	NetworkRxBytes uint64
+	// NetworkTxBytes is an amount of bytes sent by the container during the period
+	NetworkTxBytes uint64
+}
+
+// ResourceSampler samples resource usage of the benchmarked container in background
+type ResourceSampler interface {
+	// Reset starts a new period of sampling
+	Reset()
+	// Collect returns resource usage aggregated since the last Reset
+	Collect() ResourceStats
+}
+
+// CPUCounter reads CPU accounting of the benchmarked container
+type CPUCounter interface {
+	// CPUUsage returns total CPU time consumed by the container processes
+	CPUUsage(ctx context.Context) (time.Duration, error)
+}
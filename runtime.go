@@ -0,0 +1,93 @@
+package performance
+
+import (
+	"runtime"
+	"time"
+)
+
+// runtimeSampleInterval is an interval of heap sampling, reading memory statistics stops the world,
+// so it should not be too frequent
+const runtimeSampleInterval = 50 * time.Millisecond
+
+// RuntimeStats describes Go runtime and GC statistics of the current process over a period of time
+type RuntimeStats struct {
+	// GCs is an amount of completed GC cycles during the period
+	GCs uint32
+	// GCPause is a total duration of stop-the-world GC pauses during the period
+	GCPause time.Duration
+	// HeapInUse is an amount of bytes in in-use heap spans at the end of the period
+	HeapInUse uint64
+	// PeakHeap is the maximal sampled amount of bytes of allocated heap objects during the period
+	PeakHeap uint64
+}
+
+// RuntimeMeter measures Go runtime and GC statistics of the current process during the last round of the benchmark,
+// so they match the stored amount of operations. Reset should be passed as a round function of BenchRounds
+// and Sample should be called before each operation to get the peak of the heap
+type RuntimeMeter struct {
+	start   runtime.MemStats
+	peak    uint64
+	sampled time.Time
+	timer   BenchTimer
+}
+
+// NewRuntimeMeter starts measuring of the runtime statistics
+func NewRuntimeMeter() *RuntimeMeter {
+	m := &RuntimeMeter{}
+	m.Reset(nil)
+	return m
+}
+
+// Reset starts measuring of a new round of the benchmark with a given timer, the timer is stopped
+// while the statistics are read. Nil timer is ignored
+func (m *RuntimeMeter) Reset(t BenchTimer) {
+	m.timer = t
+	m.pause(func() {
+		runtime.ReadMemStats(&m.start)
+	})
+	m.peak = m.start.HeapAlloc
+	m.sampled = time.Now()
+}
+
+// Sample reads the heap if the sampling interval has passed since the previous sample, the timer of the round
+// is stopped while the heap is read
+func (m *RuntimeMeter) Sample() {
+	if time.Since(m.sampled) < runtimeSampleInterval {
+		return
+	}
+	var s runtime.MemStats
+	m.pause(func() {
+		runtime.ReadMemStats(&s)
+	})
+	if s.HeapAlloc > m.peak {
+		m.peak = s.HeapAlloc
+	}
+	m.sampled = time.Now()
+}
+
+// pause calls a given function with the timer of the round stopped
+func (m *RuntimeMeter) pause(f func()) {
+	if m.timer == nil {
+		f()
+		return
+	}
+	m.timer.StopTimer()
+	f()
+	m.timer.StartTimer()
+}
+
+// Stop stops measuring and returns the statistics of the period since the last Reset
+func (m *RuntimeMeter) Stop() RuntimeStats {
+	var end runtime.MemStats
+	runtime.ReadMemStats(&end)
+	if end.HeapAlloc > m.peak {
+		m.peak = end.HeapAlloc
+	}
+
+	return RuntimeStats{
+		GCs:       end.NumGC - m.start.NumGC,
+		GCPause:   time.Duration(end.PauseTotalNs - m.start.PauseTotalNs),
+		HeapInUse: end.HeapInuse,
+		PeakHeap:  m.peak,
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/orourkedd/influxdb1-client/client"
 	"github.com/src-d/envconfig"
+	"golang.org/x/tools/benchmark/parse"
 	"gopkg.in/src-d/go-errors.v1"
 	"gopkg.in/src-d/go-log.v1"
 )
@@ -66,10 +67,6 @@ func NewClient() (storage.Client, error) {
 func (c *influxClient) Dump(tags map[string]string, benchmarks ...performance.Benchmark) error {
 	wrapErr := func(err error) error { return errDumpFailed.Wrap(err) }
 
-	if tags == nil {
-		tags = make(map[string]string)
-	}
-
 	bp, err := client.NewBatchPoints(client.BatchPointsConfig{
 		Database:  c.influxConfig.Db,
 		Precision: "s",
@@ -80,20 +77,13 @@ func (c *influxClient) Dump(tags map[string]string, benchmarks ...performance.Be
 
 	eventTime := time.Now()
 	for _, b := range benchmarks {
-		bench := b.Benchmark
-		tags["name"] = bench.Name
-		fields := map[string]interface{}{
-			"n":                  bench.N,
-			storage.PerOpSeconds: time.Duration(bench.NsPerOp).Seconds(),
-			// https://github.com/influxdata/influxdb/issues/7801
-			storage.PerOpAllocBytes: int(bench.AllocedBytesPerOp),
-			storage.PerOpAllocs:     int(bench.AllocsPerOp),
-		}
+		pointTags := storage.Tags(tags, b)
+		pointTags["name"] = b.Benchmark.Name
 
 		point, err := client.NewPoint(
 			c.influxConfig.Measurement,
-			tags,
-			fields,
+			pointTags,
+			benchmarkFields(b),
 			eventTime,
 		)
 		if err != nil {
@@ -109,6 +99,35 @@ func (c *influxClient) Dump(tags map[string]string, benchmarks ...performance.Be
 	return nil
 }
 
+// benchmarkFields converts benchmark results to point fields, failed benchmarks contain only the error info
+func benchmarkFields(b performance.Benchmark) map[string]interface{} {
+	var fields map[string]interface{}
+	if b.Failed() {
+		fields = map[string]interface{}{
+			storage.Errors:       1,
+			storage.ErrorMessage: b.Error,
+		}
+	} else {
+		bench := b.Benchmark
+		fields = map[string]interface{}{
+			"n":                  bench.N,
+			storage.PerOpSeconds: time.Duration(bench.NsPerOp).Seconds(),
+			storage.Errors:       0,
+		}
+		// https://github.com/influxdata/influxdb/issues/7801
+		if bench.Measured&parse.AllocedBytesPerOp != 0 {
+			fields[storage.PerOpAllocBytes] = int(bench.AllocedBytesPerOp)
+		}
+		if bench.Measured&parse.AllocsPerOp != 0 {
+			fields[storage.PerOpAllocs] = int(bench.AllocsPerOp)
+		}
+	}
+	for k, v := range storage.Metrics(b) {
+		fields[k] = v
+	}
+	return fields
+}
+
 func (c *influxClient) Close() error {
 	return c.Client.Close()
 }
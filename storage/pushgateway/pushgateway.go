@@ -9,6 +9,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/push"
 	"github.com/src-d/envconfig"
+	"golang.org/x/tools/benchmark/parse"
 	"gopkg.in/src-d/go-log.v1"
 )
 
@@ -41,19 +42,34 @@ func NewClient() (storage.Client, error) {
 
 // Dump stores given benchmark results with tags to prometheus pushgateway
 func (c *promClient) Dump(tags map[string]string, benchmarks ...performance.Benchmark) error {
-	labels, values := performance.SplitStringMap(tags)
-	labels = append([]string{"name"}, labels...)
+	tagNames := storage.TagNames(tags, benchmarks...)
+	labels := append([]string{"name"}, tagNames...)
 
-	log.Debugf("getting metrics")
-	metrics := getMetrics(labels)
+	metrics := make(metrics)
 	for _, b := range benchmarks {
 		bench := b.Benchmark
-		tmpValues := append([]string{bench.Name}, values...)
+		benchTags := storage.Tags(tags, b)
+		tmpValues := []string{bench.Name}
+		for _, t := range tagNames {
+			tmpValues = append(tmpValues, benchTags[t])
+		}
 
 		log.Debugf("observing for the benchmark: %+v", b)
-		metrics[storage.PerOpSeconds].WithLabelValues(tmpValues...).Observe(time.Duration(bench.NsPerOp).Seconds())
-		metrics[storage.PerOpAllocBytes].WithLabelValues(tmpValues...).Observe(float64(bench.AllocedBytesPerOp))
-		metrics[storage.PerOpAllocs].WithLabelValues(tmpValues...).Observe(float64(bench.AllocsPerOp))
+		if b.Failed() {
+			metrics.observe(storage.Errors, labels, tmpValues, 1)
+		} else {
+			metrics.observe(storage.Errors, labels, tmpValues, 0)
+			metrics.observe(storage.PerOpSeconds, labels, tmpValues, time.Duration(bench.NsPerOp).Seconds())
+			if bench.Measured&parse.AllocedBytesPerOp != 0 {
+				metrics.observe(storage.PerOpAllocBytes, labels, tmpValues, float64(bench.AllocedBytesPerOp))
+			}
+			if bench.Measured&parse.AllocsPerOp != 0 {
+				metrics.observe(storage.PerOpAllocs, labels, tmpValues, float64(bench.AllocsPerOp))
+			}
+		}
+		for k, v := range storage.Metrics(b) {
+			metrics.observe(k, labels, tmpValues, v)
+		}
 	}
 
 	log.Debugf("adding metrics to the pusher")
@@ -72,12 +88,14 @@ func (c *promClient) collector(ms metrics) {
 	}
 }
 
-func getMetrics(labels []string) metrics {
-	return metrics{
-		storage.PerOpSeconds:    getMetric(storage.PerOpSeconds, labels),
-		storage.PerOpAllocBytes: getMetric(storage.PerOpAllocBytes, labels),
-		storage.PerOpAllocs:     getMetric(storage.PerOpAllocs, labels),
+// observe records the value of metric with a given name, metric is created on the first observation
+func (ms metrics) observe(name string, labels, values []string, v float64) {
+	m, ok := ms[name]
+	if !ok {
+		m = getMetric(name, labels)
+		ms[name] = m
 	}
+	m.WithLabelValues(values...).Observe(v)
 }
 
 func getMetric(name string, labels []string) *prometheus.SummaryVec {
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"github.com/bblfsh/performance"
+
+	"golang.org/x/tools/benchmark/parse"
 	"gopkg.in/src-d/go-errors.v1"
 )
 
@@ -12,6 +14,112 @@ const (
 	PerOpAllocBytes = "bblfsh_bench_allocs_bytes"
 	// PerOpAllocs represents metric of allocations per operation
 	PerOpAllocs = "bblfsh_bench_allocs"
+	// ClientAllocBytes represents metric of bytes allocated per operation by the benchmarking client, it's stored instead
+	// of PerOpAllocBytes when the benchmarked code runs in another process
+	ClientAllocBytes = "bblfsh_bench_client_allocs_bytes"
+	// ClientAllocs represents metric of allocations per operation by the benchmarking client, it's stored instead
+	// of PerOpAllocs when the benchmarked code runs in another process
+	ClientAllocs = "bblfsh_bench_client_allocs"
+	// RPCSeconds represents metric of seconds per operation spent on the request round-trip without decoding of UAST
+	RPCSeconds = "bblfsh_bench_rpc_seconds"
+	// ClientDecodeSeconds represents metric of seconds per operation spent by the client on decoding of UAST
+	ClientDecodeSeconds = "bblfsh_bench_client_decode_seconds"
+	// MBPerSecond represents metric of processed megabytes of fixture per second
+	MBPerSecond = "bblfsh_bench_mb_per_second"
+	// PerByteSeconds represents metric of seconds per byte of fixture
+	PerByteSeconds = "bblfsh_bench_seconds_per_byte"
+	// PerLineSeconds represents metric of seconds per line of fixture
+	PerLineSeconds = "bblfsh_bench_seconds_per_line"
+	// FixtureBytes represents metric of fixture size in bytes
+	FixtureBytes = "bblfsh_bench_fixture_bytes"
+	// FixtureLines represents metric of fixture size in lines
+	FixtureLines = "bblfsh_bench_fixture_lines"
+	// ColdSeconds represents metric of seconds spent on the first request for the fixture
+	ColdSeconds = "bblfsh_bench_cold_seconds"
+	// ColdStartPortSeconds represents metric of seconds from container start till its port accepts connections
+	ColdStartPortSeconds = "bblfsh_bench_cold_start_port_seconds"
+	// ColdStartMinSeconds represents metric of the fastest time from container start till the first parse
+	ColdStartMinSeconds = "bblfsh_bench_cold_start_min_seconds"
+	// ColdStartMaxSeconds represents metric of the slowest time from container start till the first parse
+	ColdStartMaxSeconds = "bblfsh_bench_cold_start_max_seconds"
+	// Errors represents metric of errors that occurred during the benchmark
+	Errors = "bblfsh_bench_errors"
+	// Timeouts represents metric of requests that exceeded the per-request timeout, benchmarks over files count them
+	// in the measured round only
+	Timeouts = "bblfsh_bench_timeouts"
+	// Retries represents metric of retries of timed out requests and requests failed with transient errors
+	Retries = "bblfsh_bench_retries"
+	// DetectionOverheadSeconds represents metric of seconds per operation added by language detection on the server
+	DetectionOverheadSeconds = "bblfsh_bench_detection_overhead_seconds"
+	// RequestBytes represents metric of uncompressed size of the parse request message in bytes
+	RequestBytes = "bblfsh_bench_request_bytes"
+	// RequestWireBytes represents metric of size of the parse request message on the wire in bytes
+	RequestWireBytes = "bblfsh_bench_request_wire_bytes"
+	// ResponseBytes represents metric of uncompressed size of the parse response message in bytes
+	ResponseBytes = "bblfsh_bench_response_bytes"
+	// ResponseWireBytes represents metric of size of the parse response message on the wire in bytes
+	ResponseWireBytes = "bblfsh_bench_response_wire_bytes"
+	// P50Seconds represents metric of the median request latency in seconds
+	P50Seconds = "bblfsh_bench_p50_seconds"
+	// P90Seconds represents metric of the 90th percentile of request latency in seconds
+	P90Seconds = "bblfsh_bench_p90_seconds"
+	// P99Seconds represents metric of the 99th percentile of request latency in seconds
+	P99Seconds = "bblfsh_bench_p99_seconds"
+	// RequestsPerSecond represents metric of successful requests per second
+	RequestsPerSecond = "bblfsh_bench_requests_per_second"
+	// FailedRequests represents metric of requests that have failed
+	FailedRequests = "bblfsh_bench_failed_requests"
+	// SaturationConcurrency represents metric of the concurrency after which throughput stops scaling
+	SaturationConcurrency = "bblfsh_bench_saturation_concurrency"
+	// PeakMemoryBytes represents metric of the maximal sampled memory usage of the container in bytes
+	PeakMemoryBytes = "bblfsh_bench_peak_memory_bytes"
+	// MemorySlope represents metric of memory growth of the container in bytes per hour
+	MemorySlope = "bblfsh_bench_memory_slope_bytes_per_hour"
+	// LatencyDrift represents metric of the ratio of median latency at the end of the test to the one at the start
+	LatencyDrift = "bblfsh_bench_latency_drift"
+	// PerOpCPUSeconds represents metric of CPU seconds consumed by the container per operation
+	PerOpCPUSeconds = "bblfsh_bench_cpu_seconds"
+	// CPUPercent represents metric of average CPU usage of the container during the benchmark, 100 stands for a single core
+	CPUPercent = "bblfsh_bench_container_cpu_percent"
+	// PeakRSSBytes represents metric of peak resident memory of the container during the benchmark in bytes
+	PeakRSSBytes = "bblfsh_bench_container_peak_rss_bytes"
+	// PageFaults represents metric of page faults in the container during the benchmark
+	PageFaults = "bblfsh_bench_container_page_faults"
+	// MajorPageFaults represents metric of major page faults in the container during the benchmark
+	MajorPageFaults = "bblfsh_bench_container_major_page_faults"
+	// NetworkRxBytes represents metric of bytes received by the container during the benchmark
+	NetworkRxBytes = "bblfsh_bench_container_network_rx_bytes"
+	// NetworkTxBytes represents metric of bytes sent by the container during the benchmark
+	NetworkTxBytes = "bblfsh_bench_container_network_tx_bytes"
+	// GCPauseSeconds represents metric of total GC pause of the benchmarking process during the last round
+	// of the benchmark in seconds
+	GCPauseSeconds = "bblfsh_bench_gc_pause_seconds"
+	// GCCount represents metric of GC cycles of the benchmarking process during the last round of the benchmark
+	GCCount = "bblfsh_bench_gc_count"
+	// HeapInUseBytes represents metric of in-use heap of the benchmarking process after the benchmark in bytes
+	HeapInUseBytes = "bblfsh_bench_heap_inuse_bytes"
+	// PeakHeapBytes represents metric of peak allocated heap of the benchmarking process during the last round
+	// of the benchmark in bytes
+	PeakHeapBytes = "bblfsh_bench_peak_heap_bytes"
+	// HostLoadPerCore represents metric of 1-minute load average per CPU core of the host before the run
+	HostLoadPerCore = "bblfsh_bench_host_load_per_core"
+	// HostSwapPagesPerSecond represents metric of swapped pages per second on the host before the run
+	HostSwapPagesPerSecond = "bblfsh_bench_host_swap_pages_per_second"
+	// HostRunningContainers represents metric of an amount of containers running on the host before the run
+	HostRunningContainers = "bblfsh_bench_host_running_containers"
+	// ServerMetricPrefix is a prefix of metrics of the benchmarked server: cumulative ones are normalized per operation,
+	// gauges are stored as is with _before and _after suffixes
+	ServerMetricPrefix = "bblfsh_bench_server_"
+	// UASTNodes represents metric of an amount of nodes in the returned UAST
+	UASTNodes = "bblfsh_bench_uast_nodes"
+	// UASTDepth represents metric of maximal depth of the returned UAST
+	UASTDepth = "bblfsh_bench_uast_depth"
+	// UASTPositions represents metric of an amount of positions in the returned UAST
+	UASTPositions = "bblfsh_bench_uast_positions"
+	// UASTBytes represents metric of serialized size of the returned UAST
+	UASTBytes = "bblfsh_bench_uast_bytes"
+	// ErrorMessage represents the message of error that caused benchmark to fail, is stored only by storages that support string values
+	ErrorMessage = "bblfsh_bench_error"
 )
 
 // Constructor is a type that represents function of default storage client Constructor
@@ -32,6 +140,112 @@ type Client interface {
 	Close() error
 }
 
+// Metrics returns additional metrics of benchmark: the ones collected during the benchmark and
+// throughput metrics that are normalized by fixture size. Size metrics are omitted if fixture size is unknown
+// or benchmark has failed
+func Metrics(b performance.Benchmark) map[string]float64 {
+	m := make(map[string]float64)
+	for k, v := range b.Metrics {
+		m[k] = v
+	}
+	if b.Failed() {
+		return m
+	}
+
+	if mbs := b.MBPerSecond(); mbs > 0 {
+		m[MBPerSecond] = mbs
+	}
+	if b.Bytes > 0 {
+		m[FixtureBytes] = float64(b.Bytes)
+		m[PerByteSeconds] = b.NsPerByte() / 1e9
+	}
+	if b.Lines > 0 {
+		m[FixtureLines] = float64(b.Lines)
+		m[PerLineSeconds] = b.NsPerLine() / 1e9
+	}
+	return m
+}
+
+// SetUASTMetrics stores the size of UAST returned for benchmarked fixture as additional metrics of benchmark
+func SetUASTMetrics(b *performance.Benchmark, s performance.UASTStats) {
+	b.SetMetric(UASTNodes, float64(s.Nodes))
+	b.SetMetric(UASTDepth, float64(s.MaxDepth))
+	b.SetMetric(UASTPositions, float64(s.Positions))
+	b.SetMetric(UASTBytes, float64(s.Bytes))
+}
+
+// SetClientAllocs moves allocations measured by the benchmark to client allocation metrics, so they are not mistaken
+// for allocations of the benchmarked server
+func SetClientAllocs(b *performance.Benchmark) {
+	if b.Benchmark.Measured&parse.AllocedBytesPerOp != 0 {
+		b.SetMetric(ClientAllocBytes, float64(b.Benchmark.AllocedBytesPerOp))
+	}
+	if b.Benchmark.Measured&parse.AllocsPerOp != 0 {
+		b.SetMetric(ClientAllocs, float64(b.Benchmark.AllocsPerOp))
+	}
+	b.Benchmark.Measured &^= parse.AllocedBytesPerOp | parse.AllocsPerOp
+	b.Benchmark.AllocedBytesPerOp = 0
+	b.Benchmark.AllocsPerOp = 0
+}
+
+// SetResourceMetrics stores resource usage of the container during the benchmark as additional metrics of benchmark,
+// nothing is stored if no samples were taken
+func SetResourceMetrics(b *performance.Benchmark, s performance.ResourceStats) {
+	if s.Samples == 0 {
+		return
+	}
+	b.SetMetric(CPUPercent, s.CPUPercent)
+	b.SetMetric(PeakRSSBytes, float64(s.PeakRSS))
+	b.SetMetric(PageFaults, float64(s.PageFaults))
+	b.SetMetric(MajorPageFaults, float64(s.MajorPageFaults))
+	b.SetMetric(NetworkRxBytes, float64(s.NetworkRxBytes))
+	b.SetMetric(NetworkTxBytes, float64(s.NetworkTxBytes))
+}
+
+// SetRuntimeMetrics stores Go runtime and GC statistics of the benchmarking process as additional metrics of benchmark
+func SetRuntimeMetrics(b *performance.Benchmark, s performance.RuntimeStats) {
+	b.SetMetric(GCPauseSeconds, s.GCPause.Seconds())
+	b.SetMetric(GCCount, float64(s.GCs))
+	b.SetMetric(HeapInUseBytes, float64(s.HeapInUse))
+	b.SetMetric(PeakHeapBytes, float64(s.PeakHeap))
+}
+
+// SetServerMetrics stores the benchmarked server metrics: changes of cumulative ones per operation and values
+// of gauges before and after the benchmark, as additional metrics of benchmark
+func SetServerMetrics(b *performance.Benchmark, metrics map[string]float64) {
+	for name, v := range metrics {
+		b.SetMetric(ServerMetricPrefix+name, v)
+	}
+}
+
+// Tags merges common tags with tags specific to a given benchmark, the latter take precedence
+func Tags(common map[string]string, b performance.Benchmark) map[string]string {
+	tags := make(map[string]string, len(common)+len(b.Tags))
+	for k, v := range common {
+		tags[k] = v
+	}
+	for k, v := range b.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// TagNames returns sorted names of all tags that are used by given benchmarks including the common ones
+func TagNames(common map[string]string, benchmarks ...performance.Benchmark) []string {
+	names := make(map[string]string)
+	for k := range common {
+		names[k] = ""
+	}
+	for _, b := range benchmarks {
+		for k := range b.Tags {
+			names[k] = ""
+		}
+	}
+
+	keys, _ := performance.SplitStringMap(names)
+	return keys
+}
+
 // Register updates the map of known storage clients constructors
 func Register(kind string, c Constructor) {
 	constructors[kind] = c
@@ -43,7 +257,52 @@ func NewClient(kind string) (Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	return c()
+	client, err := c()
+	if err != nil {
+		return nil, err
+	}
+	return tracedClient{Client: client, kind: kind}, nil
+}
+
+// SetHostMetrics stores values observed by the host check as additional metrics of benchmark
+func SetHostMetrics(b *performance.Benchmark, c performance.HostCheck) {
+	b.SetMetric(HostLoadPerCore, c.LoadPerCore)
+	b.SetMetric(HostSwapPagesPerSecond, c.SwapPagesPerSecond)
+	if c.RunningContainers >= 0 {
+		b.SetMetric(HostRunningContainers, float64(c.RunningContainers))
+	}
+}
+
+// WithHostMetrics returns copies of given benchmarks with values observed by the host check stored as their metrics,
+// benchmarks are returned as is if the host was not checked
+func WithHostMetrics(benchmarks []performance.Benchmark) []performance.Benchmark {
+	check, ok := performance.LastHostCheck()
+	if !ok {
+		return benchmarks
+	}
+	res := make([]performance.Benchmark, len(benchmarks))
+	for i, b := range benchmarks {
+		metrics := make(map[string]float64, len(b.Metrics)+3)
+		for k, v := range b.Metrics {
+			metrics[k] = v
+		}
+		b.Metrics = metrics
+		SetHostMetrics(&b, check)
+		res[i] = b
+	}
+	return res
+}
+
+// tracedClient traces dumps of the underlying client
+type tracedClient struct {
+	Client
+	kind string
+}
+
+// Dump implements Client
+func (c tracedClient) Dump(tags map[string]string, benchmarks ...performance.Benchmark) error {
+	defer performance.Trace(performance.TraceCategoryPhase, "storage dump", map[string]string{"storage": c.kind})()
+	return c.Client.Dump(tags, benchmarks...)
 }
 
 // ValidateKind checks if a given kind is supported
@@ -0,0 +1,160 @@
+package performance
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// TraceCategoryPhase is a category of trace events of run phases
+	TraceCategoryPhase = "phase"
+	// TraceCategoryDocker is a category of trace events of docker operations
+	TraceCategoryDocker = "docker"
+	// TraceCategoryRequest is a category of trace events of individual requests
+	TraceCategoryRequest = "request"
+
+	// TraceSampleTag is a storage label of traced runs that contains the sampling rate of traced requests,
+	// tracing adds overhead to the benchmarks
+	TraceSampleTag = "trace_sample"
+)
+
+// traceEvent is an event of Chrome trace-event format, see
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type traceEvent struct {
+	Name     string `json:"name"`
+	Category string `json:"cat"`
+	Phase    string `json:"ph"`
+	// Timestamp and Duration are in microseconds
+	Timestamp int64             `json:"ts"`
+	Duration  int64             `json:"dur,omitempty"`
+	PID       int               `json:"pid"`
+	TID       int               `json:"tid"`
+	ID        int               `json:"id,omitempty"`
+	Args      map[string]string `json:"args,omitempty"`
+}
+
+// tracer collects trace events of the run, nil tracer means tracing is disabled
+type tracer struct {
+	// requests is a counter of requests used for sampling, it's updated atomically
+	requests int64
+
+	mu          sync.Mutex
+	start       time.Time
+	events      []traceEvent
+	sampleEvery int64
+}
+
+var globalTracer *tracer
+
+// StartTrace enables collection of trace events, every sampleEvery-th request is traced
+func StartTrace(sampleEvery int) {
+	if sampleEvery < 1 {
+		sampleEvery = 1
+	}
+	globalTracer = &tracer{start: time.Now(), sampleEvery: int64(sampleEvery)}
+}
+
+// traceTags returns the tag that marks traced runs, no tags are returned if tracing is not enabled
+func traceTags() map[string]string {
+	t := globalTracer
+	if t == nil {
+		return nil
+	}
+	return map[string]string{TraceSampleTag: strconv.FormatInt(t.sampleEvery, 10)}
+}
+
+// Trace starts the span of a given category and name with given arguments, returned function ends the span.
+// It does nothing if tracing is not enabled. Spans of one category should be nested, they are drawn in one row
+func Trace(category, name string, args map[string]string) func() {
+	t := globalTracer
+	if t == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		t.add(traceEvent{
+			Name:      name,
+			Category:  category,
+			Phase:     "X",
+			Timestamp: t.since(start),
+			Duration:  int64(time.Since(start) / time.Microsecond),
+			TID:       traceThread(category),
+			Args:      args,
+		})
+	}
+}
+
+// TraceRequest starts the span of a sampled request of a given name, returned function ends the span.
+// Requests may overlap, so they are traced as async events
+func TraceRequest(name string) func() {
+	t := globalTracer
+	if t == nil {
+		return func() {}
+	}
+
+	id := atomic.AddInt64(&t.requests, 1)
+	if id%t.sampleEvery != 0 {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		end := time.Now()
+		e := traceEvent{
+			Name:     name,
+			Category: TraceCategoryRequest,
+			TID:      traceThread(TraceCategoryRequest),
+			ID:       int(id),
+		}
+		b, f := e, e
+		b.Phase, b.Timestamp = "b", t.since(start)
+		f.Phase, f.Timestamp = "e", t.since(end)
+		t.add(b, f)
+	}
+}
+
+// WriteTrace writes collected events to a file of a given path in Chrome trace-event JSON format,
+// it can be opened in chrome://tracing or Perfetto. It does nothing if tracing is not enabled
+func WriteTrace(path string) error {
+	t := globalTracer
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	data, err := json.Marshal(struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}{t.events})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func (t *tracer) add(events ...traceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, events...)
+}
+
+// since returns the timestamp of a given time relative to the start of the trace
+func (t *tracer) since(ts time.Time) int64 {
+	return int64(ts.Sub(t.start) / time.Microsecond)
+}
+
+// traceThread returns the row of trace viewer a given category is drawn in
+func traceThread(category string) int {
+	switch category {
+	case TraceCategoryDocker:
+		return 1
+	case TraceCategoryRequest:
+		return 2
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,65 @@
+package performance
+
+import (
+	"github.com/bblfsh/sdk/v3/uast"
+	"github.com/bblfsh/sdk/v3/uast/nodes"
+	"github.com/bblfsh/sdk/v3/uast/nodes/nodesproto"
+)
+
+// UASTStats describes the size of UAST returned for a fixture
+type UASTStats struct {
+	// Nodes is an amount of objects, arrays and values in the tree
+	Nodes int64
+	// MaxDepth is the maximal depth of the tree
+	MaxDepth int64
+	// Positions is an amount of uast:Position nodes, native ASTs usually have none of them
+	Positions int64
+	// Bytes is a size of the tree serialized to the protocol format
+	Bytes int64
+}
+
+// NewUASTStats walks a given tree and measures its size
+func NewUASTStats(n nodes.Node) (UASTStats, error) {
+	var s UASTStats
+	s.walk(n, 1)
+
+	var w countingWriter
+	if err := nodesproto.WriteTo(&w, n); err != nil {
+		return UASTStats{}, err
+	}
+	s.Bytes = int64(w)
+
+	return s, nil
+}
+
+func (s *UASTStats) walk(n nodes.Node, depth int64) {
+	if n == nil {
+		return
+	}
+	s.Nodes++
+	if depth > s.MaxDepth {
+		s.MaxDepth = depth
+	}
+
+	switch n := n.(type) {
+	case nodes.Object:
+		if uast.TypeOf(n) == uast.TypePosition {
+			s.Positions++
+		}
+		for _, v := range n {
+			s.walk(v, depth+1)
+		}
+	case nodes.Array:
+		for _, v := range n {
+			s.walk(v, depth+1)
+		}
+	}
+}
+
+// countingWriter discards the data written to it and counts its size
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}